@@ -0,0 +1,8 @@
+//go:build !unix
+
+package gfrn
+
+// writableDir can't be checked without changing the directory here, so it's assumed
+func writableDir(path string) bool {
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package gfrn
+
+import "golang.org/x/sys/unix"
+
+// writableDir is true when entries can be created, removed and renamed in the directory
+func writableDir(path string) bool {
+	return unix.Access(path, unix.W_OK|unix.X_OK) == nil
+}
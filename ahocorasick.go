@@ -0,0 +1,105 @@
+package gfrn
+
+// acMatcher finds any of many literal finds in one pass over the text, however many there
+// are, where a regex of them all slows with each one added. it's an aho-corasick automaton
+// made into a dfa over just the bytes the finds use, case-folded for ascii unless exact
+type acMatcher struct {
+	class  [256]int
+	width  int     // byte classes, 0 being every byte no find has
+	delta  []int32 // next state, by state*width + class
+	out    []int32 // length of the longest find ending at each state, 0 for none
+	maxLen int
+}
+
+func newACMatcher(finds []string, exact bool) *acMatcher {
+	a := &acMatcher{}
+	norm := func(c byte) byte {
+		if exact {
+			return c
+		}
+		return toLowerASCII(c)
+	}
+
+	a.width = 1
+	for _, f := range finds {
+		for i := 0; i < len(f); i++ {
+			if c := norm(f[i]); a.class[c] == 0 {
+				a.class[c] = a.width
+				a.width++
+			}
+		}
+		if len(f) > a.maxLen {
+			a.maxLen = len(f)
+		}
+	}
+	if !exact {
+		for c := 'A'; c <= 'Z'; c++ {
+			a.class[c] = a.class[c+'a'-'A']
+		}
+	}
+
+	// the trie of the finds
+	a.delta = make([]int32, a.width)
+	a.out = []int32{0}
+	for _, f := range finds {
+		s := 0
+		for i := 0; i < len(f); i++ {
+			at := s*a.width + a.class[norm(f[i])]
+			if a.delta[at] == 0 {
+				a.delta[at] = int32(len(a.out))
+				a.delta = append(a.delta, make([]int32, a.width)...)
+				a.out = append(a.out, 0)
+			}
+			s = int(a.delta[at])
+		}
+		if int32(len(f)) > a.out[s] {
+			a.out[s] = int32(len(f))
+		}
+	}
+
+	// then, shallowest states first, where each goes on a byte the trie doesn't have: where
+	// its longest suffix that's also in the trie goes
+	fail := make([]int32, len(a.out))
+	queue := []int{}
+	for c := 0; c < a.width; c++ {
+		if s := a.delta[c]; s != 0 {
+			queue = append(queue, int(s))
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if a.out[fail[s]] > a.out[s] {
+			a.out[s] = a.out[fail[s]]
+		}
+		for c := 0; c < a.width; c++ {
+			at, next := s*a.width+c, int(fail[s])*a.width+c
+			if t := a.delta[at]; t != 0 {
+				fail[t] = a.delta[next]
+				queue = append(queue, int(t))
+			} else {
+				a.delta[at] = a.delta[next]
+			}
+		}
+	}
+	return a
+}
+
+// find returns where the leftmost match at or after from starts and ends, the longest
+// when more than one starts there, as the regex of the finds longest first would, or -1
+func (a *acMatcher) find(b []byte, from int) (int, int) {
+	s, start, end := 0, -1, -1
+	for i := from; i < len(b); i++ {
+		// nothing ending from here on can start before the match found
+		if start != -1 && i-a.maxLen >= start {
+			break
+		}
+		s = int(a.delta[s*a.width+a.class[b[i]]])
+		if n := int(a.out[s]); n > 0 {
+			if st := i + 1 - n; start == -1 || st < start || st == start && i+1 > end {
+				start, end = st, i+1
+			}
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,66 @@
+package gfrn
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the automaton should find just what the regex of the finds, longest first, does
+func TestACMatchesRegex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	word := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < 1+r.Intn(n); i++ {
+			sb.WriteByte("abcAB"[r.Intn(5)])
+		}
+		return sb.String()
+	}
+
+	for run := 0; run < 500; run++ {
+		pairs := [][2]string{}
+		from := []int{}
+		seen := map[string]bool{}
+		exact := run%2 == 0
+		for len(pairs) < 1+r.Intn(8) {
+			f := word(5)
+			if !exact {
+				f = strings.ToLower(f)
+			}
+			if !seen[f] {
+				seen[f] = true
+				pairs = append(pairs, [2]string{f, "x"})
+				from = append(from, len(from))
+			}
+		}
+		m, err := newPairsMatcher(pairs, from, len(pairs), exact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.ac == nil {
+			t.Fatal("no automaton for ascii finds")
+		}
+
+		text := []byte(word(200))
+		got := m.findAll(text)
+		want := m.reg.FindAllIndex(text, -1)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("finds %q in %q: got %v, want %v", pairs, text, got, want)
+		}
+	}
+}
+
+func TestACNonASCII(t *testing.T) {
+	pairs := [][2]string{{"Ünï", "X"}, {"b", "Y"}}
+	m, err := newPairsMatcher(pairs, []int{0, 1}, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ac != nil {
+		t.Fatal("folding non ascii finds needs the regex")
+	}
+	if out, n := m.replaceAll([]byte("ünï B"), ""); string(out) != "X Y" || n != 2 {
+		t.Errorf("got %q, %d", out, n)
+	}
+}
@@ -0,0 +1,264 @@
+package gfrn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Plan works out what Run would do with opts, the renames and how every changed file's
+// contents hash before and after, without changing anything
+func (e *Engine) Plan(ctx context.Context, opts Options) (Plan, error) {
+	done := e.begin(opts)
+	defer done()
+
+	if opts.Dir != "" {
+		dir, err := filepath.Abs(opts.Dir)
+		if err != nil {
+			return Plan{}, err
+		}
+		opts.Dir = dir
+	}
+
+	if opts.Semantic {
+		return Plan{}, fmt.Errorf("-semantic can't be planned, gopls makes its changes itself")
+	}
+
+	s, err := prepare(ctx, opts)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	renames, err := e.resolveConflicts(addSidecars(e.findRenames(opts.Dir, s.replace, s.m, s.wf, opts), opts.Sidecars, s.wf), opts.OnConflict)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{
+		Dir:           opts.Dir,
+		Renames:       relRenames(opts.Dir, renames),
+		Files:         []PlanFile{},
+		Find:          opts.Find,
+		Replace:       opts.Replace,
+		Pairs:         opts.Pairs,
+		CaseSensitive: opts.CaseSensitive,
+		Regex:         opts.Regex,
+		Smartcase:     opts.Smartcase,
+		WholeWord:     opts.WholeWord,
+		Not:           opts.Not,
+		Charset:       opts.Charset,
+		EOL:           opts.EOL,
+	}
+
+	e.progress.phase(PhaseContents)
+	for rd := range e.streamRead(e.walkTextFiles(opts.Dir, s.wf), s.wf, true) {
+		var wr WriteOp
+		var ok bool
+		if opts.FileTimeout > 0 {
+			wr, ok = e.updateWithin(rd, s.m, s.replace, opts.FileTimeout)
+		} else {
+			wr, ok = e.updateFile(rd, s.m, s.replace)
+		}
+		if !ok {
+			continue
+		}
+
+		contents, err := encodeContents(withLineEnding(wr.Path, wr.Contents, s.eol), wr.Charset)
+		if err != nil {
+			e.console.println("Couldn't encode", wr.Path, "back to", wr.Charset, err)
+			continue
+		}
+		plan.Files = append(plan.Files, PlanFile{Path: relSlash(opts.Dir, rd.Path), OldHash: rd.Hash, NewHash: hashBytes(contents), Matches: wr.Matches, Lines: planLines(rd.Contents, wr.Contents)})
+		e.progress.changed(rd.Path, wr.Matches)
+	}
+	sortByPath(plan.Files, func(i int) string { return plan.Files[i].Path })
+	for _, path := range s.wf.takeLarge() {
+		e.console.println("Left", path, "out of the plan, it's over -max-size and plans can't be streamed")
+	}
+
+	e.console.println("Planned", len(plan.Renames), "renames and", len(plan.Files), "file changes in", opts.Dir)
+	return plan, nil
+}
+
+// Apply carries out a plan on the tree at opts.Dir, or the one the plan was made against
+// when that's blank, writing files the way opts says: Lock, Atomic, Fsync, Mode and the temp
+// settings. what's found and replaced comes from the plan. every file is checked first. one
+// that's been edited since the plan was made has the plan's line changes merged into it,
+// and nothing is changed if any of those conflict with the edits, or a file wouldn't come
+// out of the replacement as planned
+func (e *Engine) Apply(ctx context.Context, plan Plan, opts Options) (Report, error) {
+	done := e.begin(opts)
+	defer done()
+
+	root := opts.Dir
+	if root == "" {
+		root = plan.Dir
+	}
+	root = filepath.Clean(root)
+
+	start := time.Now()
+	sum := &Report{Dir: root, Find: plan.Find, Replace: plan.Replace}
+	err := e.apply(ctx, plan, root, opts, sum)
+	if err != nil {
+		sum.Error = err.Error()
+	}
+	sum.Skipped = e.skips.take()
+	sum.total(e.tally, e.progress.timings())
+	sum.printExts(e.console, opts.Stats)
+	sum.Elapsed = time.Since(start).String()
+	return *sum, err
+}
+
+func (e *Engine) apply(ctx context.Context, plan Plan, root string, opts Options, sum *Report) error {
+	m, _, err := compileMatcher(Options{Find: plan.Find, Replace: plan.Replace, Pairs: plan.Pairs, CaseSensitive: plan.CaseSensitive, Regex: plan.Regex, Smartcase: plan.Smartcase, WholeWord: plan.WholeWord, Not: plan.Not})
+	if err != nil {
+		return err
+	}
+	replace := nativeSeparators(plan.Replace)
+	wf := &walkFilter{charset: plan.Charset}
+	eol, err := eolOf(plan.EOL)
+	if err != nil {
+		return err
+	}
+
+	e.progress.phase(PhaseCheck)
+	problems := 0
+	missing := map[string]bool{}
+	for _, rn := range plan.Renames {
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rn.Old))); err != nil {
+			e.console.println("missing  ", rn.Old)
+			missing[rn.Old] = true
+			problems++
+		}
+	}
+
+	// the plan's conflicts were settled when it was made, so any now are new
+	renames := absRenames(root, plan.Renames)
+	for _, c := range findConflicts(renames) {
+		e.console.println("conflict ", c.describe(renames))
+		problems++
+	}
+
+	paths := make(chan string, len(plan.Files))
+	files := map[string]PlanFile{}
+	for _, pf := range plan.Files {
+		if missing[pf.Path] {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(pf.Path))
+		files[path] = pf
+		paths <- path
+	}
+	close(paths)
+
+	checked := map[string]bool{}
+	merged := map[string]WriteOp{}
+	for rd := range e.streamRead(paths, wf, true) {
+		pf := files[rd.Path]
+		checked[pf.Path] = true
+		if rd.Hash != pf.OldHash && pf.Lines == nil {
+			e.console.println("changed  ", pf.Path)
+			problems++
+			continue
+		}
+		if rd.Hash != pf.OldHash {
+			contents, conflicts := mergeLines(rd.Contents, pf.Lines, m)
+			if len(conflicts) > 0 {
+				e.console.println("conflict ", pf.Path)
+				for _, c := range conflicts {
+					e.console.println("  ", c)
+				}
+				problems++
+				continue
+			}
+			e.console.println("merged   ", pf.Path)
+			merged[pf.Path] = WriteOp{Contents: contents, Charset: rd.Charset, Matches: pf.Matches}
+			continue
+		}
+
+		wr, _ := e.updateFile(rd, m, replace)
+		contents, err := encodeContents(withLineEnding(wr.Path, wr.Contents, eol), wr.Charset)
+		if err != nil || hashBytes(contents) != pf.NewHash {
+			e.console.println("differs  ", pf.Path)
+			problems++
+		}
+	}
+	for _, pf := range plan.Files {
+		if !checked[pf.Path] && !missing[pf.Path] {
+			e.console.println("missing  ", pf.Path)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problems found checking %v against the plan, nothing was applied", problems, root)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sum.Rules = ruleStats(ruleList(Options{Find: plan.Find, Replace: plan.Replace, Pairs: plan.Pairs}))
+	if sum.Rules != nil {
+		defer sum.endRules(e.console, m, replace)
+	}
+
+	lock, err := e.lockRun(root, opts.Takeover)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	newpath, made, err := e.renameDirs(ctx, root, renames, opts.CaseCollision, opts.Fsync, os.Rename)
+	lock.moved(newpath)
+	sum.Renames = renames[len(renames)-made:]
+	if err != nil {
+		return err
+	}
+
+	temp, err := newTempNames(opts.TempDir, opts.TempPrefix, opts.TempSuffix)
+	if err != nil {
+		return fmt.Errorf("Couldn't use temp dir %v, %s", opts.TempDir, err)
+	}
+	w := writer{lock: opts.Lock, fsync: opts.Fsync, atomic: opts.Atomic, mode: opts.Mode, eol: eol, temp: temp}
+
+	moved := make(chan string, len(plan.Files))
+	mergedOps := []WriteOp{}
+	for _, pf := range plan.Files {
+		final := filepath.Join(newpath, filepath.FromSlash(plan.finalPath(pf.Path)))
+		if wr, ok := merged[pf.Path]; ok {
+			wr.Path = final
+			mergedOps = append(mergedOps, wr)
+			continue
+		}
+		moved <- final
+	}
+	close(moved)
+
+	e.progress.phase(PhaseContents)
+	e.tally.reset()
+	wf.ctx = ctx // the checks read everything, only the writes stop part way
+	updates := make(chan WriteOp, e.workers)
+	go func() {
+		defer close(updates)
+		for _, wr := range mergedOps {
+			e.tally.matched.Add(1)
+			updates <- wr
+		}
+		for wr := range e.streamUpdate(e.streamRead(moved, wf, false), m, replace, 0) {
+			updates <- wr
+		}
+	}()
+	writes, err := e.brokerWrite(updates, w, nil, newpath)
+	sum.addWrites(writes)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return stoppedError(sum, err)
+	}
+
+	e.console.println("Applied", len(renames), "renames and", len(writes), "file changes in", newpath)
+	return nil
+}
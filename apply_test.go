@@ -0,0 +1,61 @@
+package gfrn
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a plan, through its json, applies to the tree it was made against as the run would have
+func TestPlanApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     func(*Options)
+		contents string
+		want     string
+	}{
+		{"map", func(o *Options) { o.Find, o.Replace, o.Pairs = "Alpha", "One", [][2]string{{"Beta", "Two"}} }, "Alpha Beta\n", "One Two\n"},
+		{"smartcase", func(o *Options) { o.Find, o.Replace, o.Smartcase = "old-name", "new-name", true }, "old_name OldName oldName\n", "new_name NewName newName\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "a.txt")
+			if err := os.WriteFile(path, []byte(tt.contents), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := DefaultOptions()
+			opts.Dir, opts.Exts = dir, []string{".txt"}
+			tt.opts(&opts)
+			e := Engine{Output: io.Discard}
+			plan, err := e.Plan(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Plan
+			if err := json.Unmarshal(b, &loaded); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := e.Apply(context.Background(), loaded, DefaultOptions()); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package gfrn
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const tempPrefix = ".gfrn-"
+
+// tempMarker is in every temp file's name whatever the prefix, so a file that only looks
+// like one under a short -temp-prefix isn't taken for a leftover
+const tempMarker = "-gfrn-"
+
+// tempNames is where temp files for atomic writes go and what they're called: in dir, or
+// next to the file being written when dir is blank or on another device than it, since a
+// rename can't cross devices. names are prefix, the pid of the run, tempMarker, a random
+// number, then suffix, so scavenge can tell a crashed run's leftovers from a running one's
+type tempNames struct {
+	dir            string
+	dev            uint64
+	prefix, suffix string
+}
+
+func newTempNames(dir, prefix, suffix string) (tempNames, error) {
+	t := tempNames{dir: dir, prefix: prefix, suffix: suffix}
+	if t.prefix == "" {
+		t.prefix = tempPrefix
+	}
+
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return t, err
+		}
+		if !info.IsDir() {
+			return t, fmt.Errorf("%v isn't a directory", dir)
+		}
+		t.dev, _ = deviceOf(info)
+	}
+	return t, nil
+}
+
+// dirFor is the directory to make the temp file for path in
+func (t tempNames) dirFor(path string) string {
+	dir := filepath.Dir(path)
+	if t.dir == "" {
+		return dir
+	}
+
+	if info, err := os.Stat(dir); err == nil {
+		if dev, ok := deviceOf(info); ok && dev != t.dev {
+			return dir
+		}
+	}
+	return t.dir
+}
+
+// pattern is the temp name for os.CreateTemp, which puts a random number at the *
+func (t tempNames) pattern() string {
+	return t.prefix + strconv.Itoa(os.Getpid()) + tempMarker + "*" + t.suffix
+}
+
+func (t tempNames) name(dir string) string {
+	return filepath.Join(dir, strings.Replace(t.pattern(), "*", strconv.FormatUint(uint64(rand.Uint32()), 10), 1))
+}
+
+// pidOf returns the pid in a temp file's name, or false if name isn't one
+func (t tempNames) pidOf(name string) (int, bool) {
+	if !strings.HasPrefix(name, t.prefix) || !strings.HasSuffix(name, t.suffix) || len(name) < len(t.prefix)+len(t.suffix) {
+		return 0, false
+	}
+
+	pid, random, ok := strings.Cut(name[len(t.prefix):len(name)-len(t.suffix)], tempMarker)
+	if !ok {
+		return 0, false
+	}
+	if _, err := strconv.ParseUint(random, 10, 64); err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(pid)
+	return n, err == nil && n > 0
+}
+
+// writeAtomic replaces path with contents without the file ever being missing or partly
+// written: the contents go to a temp file, on the same device, which is then renamed over
+// path. where the platform supports it the temp file is anonymous until fully written
+func (e *Engine) writeAtomic(path string, contents []byte, mode os.FileMode, streams []string, w writer) error {
+	dir := w.temp.dirFor(path)
+
+	f, name, err := createTemp(dir, w.temp)
+	if err != nil {
+		return err
+	}
+
+	err = fillTemp(f, contents, mode, w)
+	if err == nil {
+		name, err = linkTemp(f, dir, name, w.temp)
+	}
+	f.Close()
+
+	if err == nil {
+		e.keepStreams(path, name, streams)
+		err = os.Rename(name, path)
+	}
+
+	if err != nil {
+		if name != "" {
+			os.Remove(name)
+		}
+		return err
+	}
+
+	if w.fsync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// fillTemp writes contents to f and gives it mode, the temp file otherwise getting the
+// default mode rather than the one of the file it replaces
+func fillTemp(f *os.File, contents []byte, mode os.FileMode, w writer) error {
+	_, err := f.Write(contents)
+	if err != nil {
+		return err
+	}
+
+	if mode != 0 {
+		err = f.Chmod(mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// always flushed, or a crash just after the rename could leave the file empty on
+	// filesystems that can persist the rename before the data
+	return f.Sync()
+}
+
+// createNamedTemp is the portable temp file, visible under a temp name while it is written
+func createNamedTemp(dir string, t tempNames) (*os.File, string, error) {
+	f, err := os.CreateTemp(dir, t.pattern())
+	if err != nil {
+		return nil, "", err
+	}
+
+	// CreateTemp makes files 0600, match what a plain write would have made
+	err = f.Chmod(os.ModePerm &^ processUmask)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return f, f.Name(), nil
+}
@@ -0,0 +1,38 @@
+package gfrn
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// createTemp opens an anonymous O_TMPFILE in dir, falling back to a named temp file on
+// kernels and filesystems without O_TMPFILE support. the name is blank when anonymous
+func createTemp(dir string, t tempNames) (*os.File, string, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_WRONLY|unix.O_CLOEXEC, uint32(os.ModePerm))
+	if err != nil {
+		return createNamedTemp(dir, t)
+	}
+	return os.NewFile(uintptr(fd), dir), "", nil
+}
+
+// linkTemp gives an anonymous temp file a name in dir, so it can be renamed over its target.
+// linkat only happens once the file is complete, so no partial file is ever visible
+func linkTemp(f *os.File, dir, name string, t tempNames) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+
+	for i := 0; i < 10; i++ {
+		name = t.name(dir)
+		err := unix.Linkat(unix.AT_FDCWD, fmt.Sprintf("/proc/self/fd/%d", f.Fd()), unix.AT_FDCWD, name, unix.AT_SYMLINK_FOLLOW)
+		if err == nil {
+			return name, nil
+		}
+		if err != unix.EEXIST {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("couldn't find a free temp name in %v", dir)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package gfrn
+
+import "os"
+
+func createTemp(dir string, t tempNames) (*os.File, string, error) {
+	return createNamedTemp(dir, t)
+}
+
+func linkTemp(f *os.File, dir, name string, t tempNames) (string, error) {
+	return name, nil
+}
@@ -0,0 +1,143 @@
+package gfrn
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// charsets are the encodings contents can be decoded from for matching, and encoded back
+// to when written. boms are left in the text as they are, so they round trip untouched
+var charsets = map[string]encoding.Encoding{
+	"utf-8":        encoding.Nop,
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"windows-1252": charmap.Windows1252,
+	"shift-jis":    japanese.ShiftJIS,
+}
+
+func validCharset(name string) error {
+	if _, ok := charsets[name]; ok || name == "auto" {
+		return nil
+	}
+	return fmt.Errorf("charset must be auto, utf-8, utf-16le, utf-16be, windows-1252 or shift-jis, not %v", name)
+}
+
+// decodeContents returns b as utf-8, decoded from charset, or from the charset it looks
+// like it's in when charset is auto, along with the charset to encode it back to. b is
+// returned as it is, with no charset, when it's already utf-8, or with an error when
+// decoding it and encoding it again wouldn't give back exactly the same bytes
+func decodeContents(b []byte, charset string) ([]byte, string, error) {
+	if charset == "auto" {
+		charset = detectCharset(b)
+	}
+	if charset == "" || charset == "utf-8" {
+		return b, "", nil
+	}
+
+	enc := charsets[charset]
+	decoded, err := enc.NewDecoder().Bytes(b)
+	if err == nil {
+		var encoded []byte
+		encoded, err = enc.NewEncoder().Bytes(decoded)
+		if err == nil && !bytes.Equal(encoded, b) {
+			err = fmt.Errorf("it doesn't round trip")
+		}
+	}
+	if err != nil {
+		return b, "", fmt.Errorf("isn't valid %v, %s", charset, err)
+	}
+	return decoded, charset, nil
+}
+
+// encodeContents is the reverse of decodeContents. it fails when the replacement put
+// characters in that charset can't represent
+func encodeContents(b []byte, charset string) ([]byte, error) {
+	if charset == "" {
+		return b, nil
+	}
+	return charsets[charset].NewEncoder().Bytes(b)
+}
+
+// detectCharset guesses the charset of b: utf-16 by its bom, or by its zero bytes, then
+// utf-8 if b is valid utf-8, then shift-jis if b decodes cleanly as it and has kana in it,
+// which western text misread as shift-jis won't, and windows-1252 otherwise
+func detectCharset(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	}
+
+	if charset := utf16Zeros(b); charset != "" {
+		return charset
+	}
+
+	if utf8.Valid(b) {
+		return "utf-8"
+	}
+
+	if decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(b); err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+		for _, r := range string(decoded) {
+			if r >= 0x3040 && r <= 0x30ff {
+				return "shift-jis"
+			}
+		}
+	}
+
+	return "windows-1252"
+}
+
+// utf16Zeros spots utf-16 without a bom by where its zero bytes are. text in any other
+// charset has none, while in utf-16 every ascii character, newlines and spaces included,
+// has a zero high byte. so even text that's mostly cjk has some, nearly all on the high
+// byte's side, the other side only getting them from the odd character like U+4E00.
+// with enough of them and no surrogate left unpaired it's taken as utf-16 in that order
+func utf16Zeros(b []byte) string {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return ""
+	}
+
+	var even, odd int
+	for i := 0; i < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+
+	units := len(b) / 2
+	unit := func(i int) uint16 { return uint16(b[i])<<8 | uint16(b[i+1]) }
+	charset := "utf-16be"
+	switch {
+	case odd*32 >= units && odd >= even*8:
+		unit = func(i int) uint16 { return uint16(b[i+1])<<8 | uint16(b[i]) }
+		charset = "utf-16le"
+	case even*32 >= units && even >= odd*8:
+		// big endian, as unit already reads it
+	default:
+		return ""
+	}
+
+	for i := 0; i < len(b); i += 2 {
+		u := unit(i)
+		switch {
+		case u >= 0xd800 && u < 0xdc00:
+			i += 2
+			if i >= len(b) || unit(i) < 0xdc00 || unit(i) >= 0xe000 {
+				return ""
+			}
+		case u >= 0xdc00 && u < 0xe000:
+			return ""
+		}
+	}
+	return charset
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/jasontconnell/gfrn"
+)
+
+// verify is gfrn verify [-dir path] plan.json
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	wd := fs.String("dir", "", "directory to verify, if not the one the plan was made against, e.g. a backup, mirror or other checkout")
+	fs.Usage = func() {
+		fmt.Println("usage: gfrn verify [-dir path] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	var e gfrn.Engine
+	_, err := e.Verify(fs.Arg(0), *wd)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// undo is gfrn undo -dir path
+func undo(args []string) int {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	wd := fs.String("dir", "", "directory the run was made in, under its new name if it was renamed")
+	fs.Usage = func() {
+		fmt.Println("usage: gfrn undo -dir path")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *wd == "" {
+		fs.Usage()
+		return 1
+	}
+
+	var e gfrn.Engine
+	err := e.Undo(*wd)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// writePlan is gfrn plan -out plan.json, with the flags of a run
+func writePlan(opts gfrn.Options, out string) int {
+	if out == "" {
+		fmt.Println("usage: gfrn plan -out plan.json [run flags]")
+		return 1
+	}
+
+	var e gfrn.Engine
+	plan, err := e.Plan(interruptible(), opts)
+	if err != nil {
+		fmt.Println("Couldn't make a plan", err)
+		return 1
+	}
+
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err == nil {
+		err = os.WriteFile(out, append(b, '\n'), 0666)
+	}
+	if err != nil {
+		fmt.Println("Couldn't write plan", out, err)
+		return 1
+	}
+	return 0
+}
+
+// apply is gfrn apply [-dir path] plan.json
+func apply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	wd := fs.String("dir", "", "directory to apply the plan to, if not the one it was made against")
+	atomic := fs.Bool("atomic", true, "write each file to a temp file and rename it over the original")
+	fsync := fs.Bool("fsync", false, "flush every rewritten file, and directories after renames, to disk before finishing")
+	lock := fs.Bool("lock", true, "hold an advisory lock on each file while rewriting it (unix)")
+	workers := fs.Int("workers", runtime.NumCPU(), "how many files to read, replace in and write at once, each")
+	takeover := fs.Bool("takeover", false, "when a run that died left its lock in dir, remove it and go ahead")
+	nice := fs.Int("nice", 0, "lower gfrn's cpu priority by this much, as nice does")
+	ioPriority := fs.String("io-priority", "", "gfrn's disk priority: idle, low or normal")
+	fs.Usage = func() {
+		fmt.Println("usage: gfrn apply [-dir path] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	if !lowerPriority(*nice, *ioPriority) {
+		return 1
+	}
+
+	plan, err := gfrn.LoadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Couldn't load plan", fs.Arg(0), err)
+		return 1
+	}
+
+	opts := gfrn.DefaultOptions()
+	opts.Dir, opts.Atomic, opts.Fsync, opts.Lock, opts.Workers, opts.Takeover = *wd, *atomic, *fsync, *lock, *workers, *takeover
+
+	var e gfrn.Engine
+	_, err = e.Apply(interruptible(), plan, opts)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// lintRules is gfrn lint-rules [-c] rules-file, which exits 1 when the rules have problems
+func lintRules(args []string) int {
+	fs := flag.NewFlagSet("lint-rules", flag.ExitOnError)
+	c := fs.Bool("c", false, "the rules are case sensitive, as a run with -c treats them")
+	fs.Usage = func() {
+		fmt.Println("usage: gfrn lint-rules [-c] rules-file")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	rules, err := gfrn.LoadMapFile(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Couldn't load rules", fs.Arg(0), err)
+		return 1
+	}
+
+	problems, err := gfrn.LintRules(rules, *c)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for _, p := range problems {
+		rule := rules[p.Rule]
+		fmt.Printf("rule %d, %s=%s, %s: %s\n", p.Rule+1, rule[0], rule[1], p.Kind, p.Message)
+	}
+	fmt.Println(len(rules), "rules,", len(problems), "problems")
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// diffReport is gfrn diff-report [run flags] old.json
+func diffReport(opts gfrn.Options, path string) int {
+	if path == "" {
+		fmt.Println("usage: gfrn diff-report -exts list [flags] report.json")
+		return 1
+	}
+
+	var old gfrn.Report
+	b, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(b, &old)
+	}
+	if err != nil {
+		fmt.Println("Couldn't load report", path, err)
+		return 1
+	}
+
+	var e gfrn.Engine
+	found, err := e.DiffReport(interruptible(), old, opts)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(found) > 0 {
+		return 1
+	}
+	return 0
+}
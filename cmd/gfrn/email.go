@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jasontconnell/gfrn"
+)
+
+// emailSummary mails the end of run summary to addrs, with the report attached as json
+// and csv. the server comes from GFRN_SMTP_HOST (host:port, port 25 when left off), and
+// GFRN_SMTP_USER and GFRN_SMTP_PASSWORD log in to it when set. GFRN_SMTP_FROM is the
+// sender, gfrn@ the local hostname by default
+func emailSummary(addrs []string, sum *gfrn.Report, elapsed time.Duration) error {
+	host := os.Getenv("GFRN_SMTP_HOST")
+	if host == "" {
+		return fmt.Errorf("GFRN_SMTP_HOST isn't set")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "25")
+	}
+
+	from := os.Getenv("GFRN_SMTP_FROM")
+	if from == "" {
+		name, _ := os.Hostname()
+		from = "gfrn@" + name
+	}
+
+	var auth smtp.Auth
+	if user := os.Getenv("GFRN_SMTP_USER"); user != "" {
+		h, _, _ := net.SplitHostPort(host)
+		auth = smtp.PlainAuth("", user, os.Getenv("GFRN_SMTP_PASSWORD"), h)
+	}
+
+	js, err := summaryJSON(sum)
+	if err != nil {
+		return err
+	}
+
+	subject := "gfrn finished in " + sum.Dir
+	if sum.Error != "" {
+		subject = "gfrn failed in " + sum.Dir
+	}
+
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n", from, strings.Join(addrs, ", "), subject, time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	body, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	fmt.Fprintf(body, "%v -> %v in %v\r\n\r\n", sum.Find, sum.Replace, sum.Dir)
+	fmt.Fprintf(body, "%d renames and %d files changed, %d matches replaced, in %v\r\n", len(sum.Renames), len(sum.Files), sum.Matches, elapsed.Round(time.Second))
+	if sum.Error != "" {
+		fmt.Fprintf(body, "\r\nError: %v\r\n", sum.Error)
+	}
+
+	attach(mw, "report.json", "application/json", js)
+	attach(mw, "report.csv", "text/csv", summaryCSV(sum))
+	mw.Close()
+
+	return smtp.SendMail(host, auth, from, addrs, msg.Bytes())
+}
+
+func attach(mw *multipart.Writer, name, contentType string, b []byte) {
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Disposition":       {`attachment; filename="` + name + `"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+
+	enc := base64.StdEncoding.EncodeToString(b)
+	for len(enc) > 76 {
+		part.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	part.Write([]byte(enc + "\r\n"))
+}
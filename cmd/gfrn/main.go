@@ -1,310 +1,450 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
+
+	"github.com/jasontconnell/gfrn"
+	"golang.org/x/term"
 )
 
 var defaultIgnores = ".vs,.git"
-var GOPROCESSES int = 48
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		os.Exit(undo(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apply" {
+		os.Exit(apply(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint-rules" {
+		os.Exit(lintRules(os.Args[2:]))
+	}
+
+	// gfrn plan and gfrn diff-report take the same flags as a run
+	planning := len(os.Args) > 1 && os.Args[1] == "plan"
+	diffing := len(os.Args) > 1 && os.Args[1] == "diff-report"
+	if planning || diffing {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	wd := flag.String("dir", "", "working directory")
 	f := flag.String("f", "", "what to find")
 	r := flag.String("r", "", "what to replace it with")
-	i := flag.String("i", ".vs,.git", "folders to ignore")
+	i := flag.String("i", ".vs,.git", "csv list of folder and file names to ignore, which can be patterns like *.snap")
 	c := flag.Bool("c", false, "case sensitive?")
 	exts := flag.String("exts", "", "text file extensions")
+	snapshot := flag.String("snapshot", "", "zip file to archive affected files to before making changes")
+	sampleRate := flag.String("sample", "", "percentage of text files to try the run on, without changing anything, e.g. 1%")
+	sampleFiles := flag.Int("sample-files", 0, "number of text files to try the run on, without changing anything")
+	maxTotal := flag.Int("max-total", 0, "abort without changing anything if more than this many renames and replacements would be made")
+	maxPerDir := flag.Int("max-per-dir", 0, "list directories where more than this many files would change, which usually means vendored or generated code slipped past -i")
+	maxPerDirAction := flag.String("max-per-dir-action", "warn", "when a directory goes over -max-per-dir: warn and carry on, or fail without changing anything")
+	previewLines := flag.Int("preview", 0, "only preview, printing up to this many changed lines per file before and after")
+	xdev := flag.Bool("xdev", false, "don't descend into directories on other filesystems")
+	excludeMime := flag.String("exclude-mime", "", "csv list of mime types, sniffed from contents, whose files are never rewritten, e.g. image/*,application/pdf")
+	eol := flag.String("eol", "keep", "line endings to give every rewritten file: lf, crlf, or keep each file's own")
+	chmod := flag.String("chmod", "", "octal mode to give every rewritten file, e.g. 0644")
+	detectText := flag.Bool("detect-text", false, "search files whose first bytes look like text, with no NULs or broken utf-8, making -exts optional; with -exts, only those files")
+	extCaseSensitive := flag.Bool("ext-case-sensitive", false, "match exts case sensitively, so c and C are different extensions")
+	useJournal := flag.Bool("journal", false, "record the renames and the original contents of changed files under .gfrn in dir, for gfrn undo")
+	dry := flag.Bool("dry", false, "go through the whole run, printing every rename and every file that would change, without changing anything")
+	precheck := flag.Bool("precheck", false, "before changing anything, list paths that can't be read or written and stop if there are any")
+	skipUnreadable := flag.Bool("skip-unreadable", false, "like -precheck, but leave the paths that can't be read or written out of the run instead of stopping")
+	simulateInto := flag.String("simulate-into", "", "directory to carry the run out in instead, creating the renamed directories and only the changed files, leaving dir untouched")
+	exportChanged := flag.String("export-changed", "", "tar.gz file to archive every renamed or rewritten file to, as it is after the run")
+	exportRenames := flag.String("export-renames", "", "file to write every renamed path's old and new path to after the run, tab separated, or as json when it ends in .json")
+	importRenames := flag.String("import-renames", "", "file of renames to make in dir instead of searching, in the format -export-renames writes; no f or exts needed")
+	notify := flag.Duration("notify-desktop", 0, "pop up a desktop notification when a run that took longer than this finishes, e.g. 1m")
+	report := flag.String("report", "", "json to print a json summary of the run on stdout, with the usual output on stderr instead")
+	reportFile := flag.String("report-file", "", "file to write a json summary of the run to")
+	emailReport := flag.String("email-report", "", "csv list of addresses to mail the summary of the run to, with the report attached, through the server in GFRN_SMTP_HOST")
+	reportFD := flag.Int("report-fd", 0, "open file descriptor to write a json summary of the run to, e.g. 3 with 3>report.json")
+	charset := flag.String("charset", "auto", "what text files are encoded in: auto to detect it per file, utf-8, utf-16le, utf-16be, windows-1252 or shift-jis")
+	order := flag.String("order", "", "order files go through reading, replacing and writing in: size-desc, so big files don't trail on at the end, size-asc or path; as found by default")
+	gitignore := flag.Bool("gitignore", false, "also leave alone whatever .gitignore files in dir and below leave out, as .gfrnignore files always are")
+	var sidecars sidecarsFlag
+	flag.Var(&sidecars, "sidecars", "csv list of suffixes whose files are renamed together, e.g. .cs,.Designer.cs,.resx, can be given any number of times")
+	maxSize := sizeFlag(10 << 20)
+	flag.Var(&maxSize, "max-size", "skip text files bigger than this, like 500KB or 10MB, rather than read them into memory, listing them in the summary; 0 for no limit")
+	streamLarge := flag.Bool("stream-large", false, "replace in files over -max-size a chunk at a time, rather than skipping them")
+	var pairs pairsFlag
+	flag.Var(&pairs, "map", "another old=new to replace in the same run, can be given any number of times")
+	lnk := flag.Bool("lnk", false, "also replace f in the target, working directory and icon paths of .lnk shortcut files")
+	mapFile := flag.String("mapfile", "", "file of old=new lines, or a two column .csv or .tsv, with more pairs to replace in the same run")
+	wholeWord := flag.Bool("w", false, "only replace f where it's a whole word, so Card doesn't change Cardinal or Discard, in names and contents")
+	not := flag.String("not", "", "regex for text whose matches of f are left alone, e.g. -f Acme -not AcmeLegacy; '.*AcmeLegacy.*' keeps whole lines with it as they are")
+	smartcase := flag.Bool("smartcase", false, "also replace f spelled in other cases, e.g. old-name also as OldName, oldName, OLD_NAME and old_name, each with r spelled the same way")
+	useRegex := flag.Bool("re", false, "f is a regular expression, and r can use its groups as $1 or ${name}")
+	ifContains := flag.String("if-contains", "", "regex a file's contents must also match for them to be replaced")
+	semantic := flag.Bool("semantic", false, "rename the identifier f in go files with gopls, leaving them out of the content pass")
+	useVCS := flag.Bool("vcs", false, "rename through git, hg or svn when dir is in a working copy, so moves are tracked")
+	history := flag.Bool("history", false, "rewrite every commit of the git repository at dir instead of the files on disk")
+	fileTimeout := flag.Duration("file-timeout", 0, "skip any file whose matching and replacing takes longer than this, e.g. 5s")
+	retryCount := flag.Int("retries", 2, "rounds of retrying files that failed to read or write, at the end of the run, for network shares that drop out now and then; 0 to skip them straight away")
+	retryWait := flag.Duration("retry-wait", time.Second, "how long to wait before the first round of retries, doubling each round after")
+	excludeFiles := flag.String("exclude-files", "", "csv list of files, relative to dir, to leave completely alone")
+	onlyInMatching := flag.Bool("only-in-matching-files", false, "only replace contents of files whose names match f")
+	atomic := flag.Bool("atomic", true, "write each file to a temp file, flush it and rename it over the original, so it is never missing or partly written; -atomic=false rewrites files in place")
+	fsync := flag.Bool("fsync", false, "flush every rewritten file, and directories after renames, to disk before finishing")
+	lock := flag.Bool("lock", true, "hold an advisory lock on each file while rewriting it (unix)")
+	freq := flag.Bool("freq", false, "only search, printing how often each distinct spelling of f matches")
+	count := flag.Bool("count", false, "only search, printing how many names and content matches would be affected in each path and in all, and exiting 0 when anything matched, 1 when nothing did or 2 on an error")
+	list := flag.Bool("list", false, "only search, printing each path whose name matches f and each match in contents as path:line:column: and its line; r isn't needed")
+	renameRoot := flag.Bool("rename-root", true, "rename dir itself if its name matches")
+	renameDirs := flag.Bool("rename-dirs", true, "rename directories whose names match; -rename-dirs=false leaves them as they are")
+	renameFiles := flag.Bool("rename-files", true, "rename files whose names match")
+	renameContents := flag.Bool("rename-contents", true, "replace in text files' contents; -rename-contents=false only renames, and needs no exts")
+	caseCollision := flag.String("case-collision", "warn", "when renamed names would differ only by case from a sibling: warn or fail")
+	onConflict := flag.String("on-conflict", "fail", "when renames would land on the same name, or one already there: fail, skip them, suffix their names with -2, -3... or overwrite what's there")
+	showStats := flag.Bool("stats", false, "at the end, also break the run down by extension: files scanned, changed, renamed and skipped, and matches")
+	showProgress := flag.Bool("progress", false, "show files walked, read and written, MB read and time left as the run goes, on stderr: a line kept up to date on a terminal, or one every 10s otherwise")
+	interactive := flag.Bool("interactive", false, "ask before each rename and each file rewrite, showing the new name or the lines that change: y, n, a for yes to all the rest, or q to stop")
+	quarantine := flag.Bool("quarantine", false, "hold back files where f matches inside a url, guid, base64 blob or binary looking line, and ask before rewriting them")
+	workers := flag.Int("workers", runtime.NumCPU(), "how many files to read, replace in and write at once, each; fewer suits a spinning disk or network mount")
+	owner := flag.String("owner", "", "user name or uid whose files are the only ones renamed or rewritten (unix)")
+	tempDir := flag.String("temp-dir", "", "directory for -atomic's temp files, instead of next to each file; files on other devices still get theirs next to them")
+	tempPrefix := flag.String("temp-prefix", ".gfrn-", "what -atomic's temp file names start with")
+	tempSuffix := flag.String("temp-suffix", "", "what -atomic's temp file names end with, e.g. .tmp to match an existing ignore rule")
+	takeover := flag.Bool("takeover", false, "when a run that died left its lock in dir, remove it and that run's temp files and go ahead")
+	nice := flag.Int("nice", 0, "lower gfrn's cpu priority by this much, as nice does, so a long run doesn't slow down everything else")
+	ioPriority := flag.String("io-priority", "", "gfrn's disk priority: idle, low or normal (linux; windows takes idle and low as background mode)")
+	planOut := flag.String("out", "", "with gfrn plan, the json file to write the plan to")
 	flag.Parse()
 
-	if *wd == "" || *f == "" || *exts == "" {
-		fmt.Println("Dir, Find and Exts must be specified and non-blank")
-		flag.PrintDefaults()
+	if !lowerPriority(*nice, *ioPriority) {
 		os.Exit(1)
 	}
 
-	if !strings.HasPrefix(*i, defaultIgnores) {
-		*i = defaultIgnores + *i
+	if *mapFile != "" {
+		filePairs, err := gfrn.LoadMapFile(*mapFile)
+		if err != nil {
+			fmt.Println("Couldn't load map file", *mapFile, err)
+			os.Exit(1)
+		}
+		pairs = append(pairs, filePairs...)
 	}
 
-	start := time.Now()
+	if !diffing && *importRenames == "" && (*wd == "" || *f == "" && len(pairs) == 0 || *exts == "" && !*detectText && *renameContents) {
+		fmt.Println("Dir, Find and Exts must be specified and non-blank, or -detect-text instead of Exts")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
 
-	err := run(*wd, *f, *r, *i, *exts, *c)
+	rate, err := parseSampleRate(*sampleRate)
 	if err != nil {
-		fmt.Println("Couldn't do it man", err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	fmt.Println("Finished", time.Since(start))
-}
-
-func run(dir, find, replace, ignoredirs, textExtensions string, caseSensitive bool) error {
-	var p string
-	p = strings.Replace(find, `\`, `\\`, -1)
-	p = strings.Replace(p, ".", "\\.", -1)
-
-	pattern := "(?i:.*(" + strings.ToLower(p) + ").*)"
-	reg := regexp.MustCompile(pattern)
-	ignores := splitToMap(strings.ToLower(ignoredirs), ",", "")
-	extMap := splitToMap(textExtensions, ",", ".")
-
-	var err error
-
-	// do directories first. then we won't have to worry about stuff moving
-	newpath, err := renameDirs(dir, replace, reg, ignores)
+	if *report != "" && *report != "json" {
+		fmt.Println("report must be json")
+		os.Exit(1)
+	}
 
+	mode, err := parseMode(*chmod)
 	if err != nil {
-		return err
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	err = replaceContents(newpath, replace, reg, extMap, ignores)
-
-	return err
-}
-
-type RenameOp struct {
-	Old, New string
-}
+	if !strings.HasPrefix(*i, defaultIgnores) {
+		*i = defaultIgnores + "," + *i
+	}
 
-type ReadOp struct {
-	Path     string
-	Contents []byte
-}
+	start := time.Now()
 
-type WriteOp struct {
-	Path     string
-	Contents []byte
-}
+	opts := gfrn.Options{
+		Dir:           *wd,
+		Find:          *f,
+		Replace:       *r,
+		Ignore:        splitList(*i),
+		Exts:          splitList(*exts),
+		CaseSensitive: *c,
+		Snapshot:      *snapshot,
+		SampleRate:    rate,
+		SampleFiles:   *sampleFiles,
+		CaseCollision: *caseCollision,
+		OnConflict:    *onConflict,
+		RenameRoot:    *renameRoot,
+		RenameDirs:    *renameDirs,
+		RenameFiles:   *renameFiles,
+		Freq:          *freq,
+		List:          *list,
+		Stats:         *showStats,
+		Count:         *count,
+		MaxTotal:      *maxTotal,
+		MaxPerDir:     *maxPerDir,
+		Preview:       *previewLines,
+		Lock:          *lock,
+		XDev:          *xdev,
+		ExcludeMime:   splitList(*excludeMime),
+		Mode:          mode,
+		EOL:           *eol,
+		Fsync:         *fsync,
+		Atomic:        *atomic,
+
+		OnlyInMatchingFiles: *onlyInMatching,
+		RenameContents:      *renameContents,
+		MaxPerDirAction:     *maxPerDirAction,
+		ExcludeFiles:        splitList(*excludeFiles),
+		FileTimeout:         *fileTimeout,
+		Retries:             *retryCount,
+		RetryWait:           *retryWait,
+		History:             *history,
+		VCS:                 *useVCS,
+		Semantic:            *semantic,
+		IfContains:          *ifContains,
+		Charset:             *charset,
+		ExportChanged:       *exportChanged,
+		ExportRenames:       *exportRenames,
+		ImportRenames:       *importRenames,
+		Takeover:            *takeover,
+		SimulateInto:        *simulateInto,
+		Precheck:            *precheck,
+		SkipUnreadable:      *skipUnreadable,
+		Dry:                 *dry,
+		Journal:             *useJournal,
+		ExtCaseSensitive:    *extCaseSensitive,
+		DetectText:          *detectText,
+		Regex:               *useRegex,
+		Smartcase:           *smartcase,
+		WholeWord:           *wholeWord,
+		Not:                 *not,
+		Pairs:               pairs,
+		Lnk:                 *lnk,
+		Workers:             *workers,
+		Owner:               *owner,
+		TempDir:             *tempDir,
+		TempPrefix:          *tempPrefix,
+		TempSuffix:          *tempSuffix,
+		Sidecars:            sidecars,
+		Order:               *order,
+		MaxSize:             int64(maxSize),
+		StreamLarge:         *streamLarge,
+		GitIgnore:           *gitignore,
+		Quarantine:          *quarantine,
+		Confirm:             confirm,
+	}
+	if *interactive {
+		opts.Ask = ask
+	}
 
-func renameDirs(dir, replace string, reg *regexp.Regexp, ignoreMap map[string]bool) (string, error) {
-	renames := []RenameOp{} // do a list so they're processed in the correct order
+	if planning {
+		os.Exit(writePlan(opts, *planOut))
+	}
+	if diffing {
+		os.Exit(diffReport(opts, flag.Arg(0)))
+	}
 
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Println(err)
-			return err
+	var e gfrn.Engine
+	out := os.Stdout
+	if *report == "json" {
+		e.Output, out, prompts = os.Stderr, os.Stderr, os.Stderr
+	}
+	if *showProgress && !*interactive {
+		m := newMeter(os.Stderr)
+		opts.Progress = m.update
+		if e.Output == nil {
+			e.Output = os.Stdout
 		}
+		e.Output = m.writer(e.Output)
+	}
 
-		lname := strings.ToLower(info.Name())
-
-		if _, ok := ignoreMap[lname]; ok && info.IsDir() {
-			return filepath.SkipDir
-		}
+	sum, err := e.Run(interruptible(), opts)
+	if err != nil {
+		fmt.Fprintln(out, "Couldn't do it man", err)
+	}
 
-		matches := reg.FindAllStringSubmatch(info.Name(), -1)
-		if len(matches) == 0 {
-			return nil
+	if *report == "json" {
+		b, err := summaryJSON(&sum)
+		if err == nil {
+			_, err = os.Stdout.Write(b)
 		}
-
-		curdir := filepath.Dir(path)
-		s := matches[0][1]
-
-		newthisname := strings.Replace(info.Name(), s, replace, -1)
-		renameTo := filepath.Join(curdir, newthisname)
-		renames = append(renames, RenameOp{Old: path, New: renameTo})
-
-		return nil
-	})
-
-	for i := len(renames) - 1; i >= 0; i-- {
-		value := renames[i]
-		err := os.Rename(value.Old, value.New)
 		if err != nil {
-			return dir, fmt.Errorf("Couldn't rename %v to %v, %s", value.Old, value.New, err)
+			fmt.Fprintln(out, "Couldn't write report", err)
 		}
 	}
 
-	newpath := dir
-	if len(renames) > 0 && renames[0].Old == dir {
-		newpath = renames[0].New
-	}
-
-	return newpath, nil
-}
-
-func replaceContents(dir, replace string, reg *regexp.Regexp, extMap, ignoreMap map[string]bool) error {
-	readPaths := []string{}
-
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	elapsed := time.Since(start)
+	if *reportFile != "" || *reportFD > 0 {
+		err = writeSummary(&sum, *reportFile, *reportFD)
 		if err != nil {
-			fmt.Println(err)
-			return err
+			fmt.Fprintln(out, "Couldn't write report", err)
 		}
+	}
 
-		lname := strings.ToLower(info.Name())
-
-		if _, ok := ignoreMap[lname]; ok && info.IsDir() {
-			return filepath.SkipDir
+	if *emailReport != "" {
+		err = emailSummary(splitList(*emailReport), &sum, elapsed)
+		if err != nil {
+			fmt.Fprintln(out, "Couldn't email report", err)
 		}
+	}
 
-		if info.IsDir() {
-			return nil
+	if *notify > 0 && elapsed >= *notify {
+		title, message := "gfrn finished", fmt.Sprintf("%d renames and %d files changed in %v, in %v", len(sum.Renames), len(sum.Files), opts.Dir, elapsed.Round(time.Second))
+		if sum.Error != "" {
+			title, message = "gfrn failed", sum.Error
 		}
-
-		ext := filepath.Ext(strings.ToLower(info.Name()))
-
-		if _, ok := extMap[ext]; !ok || len(ext) == 0 {
-			return nil
+		err = notifyDesktop(title, message)
+		if err != nil {
+			fmt.Fprintln(out, "Couldn't show a desktop notification", err)
 		}
+	}
 
-		readPaths = append(readPaths, path)
-
-		return nil
-	})
+	if !*freq && !*list && !*count && !*history && *previewLines == 0 && rate == 0 && *sampleFiles == 0 {
+		printTotals(out, &sum, *dry)
+	}
+	fmt.Fprintln(out, "Finished", time.Since(start))
 
-	reads := brokerRead(readPaths)
-	writes := brokerUpdate(reads, reg, replace)
-	brokerWrite(writes)
+	if *count {
+		os.Exit(countStatus(&sum))
+	}
+	if sum.Error != "" || sum.Totals.Failed > 0 {
+		os.Exit(1)
+	}
+}
 
-	return nil
+// countStatus is -count's exit code, like grep's: 0 when anything matched, 1 when nothing
+// did, or 2 when the search failed
+func countStatus(sum *gfrn.Report) int {
+	switch {
+	case sum.Error != "":
+		return 2
+	case len(sum.Found) > 0:
+		return 0
+	}
+	return 1
 }
 
-func brokerRead(list []string) []ReadOp {
-	readOps := make(chan ReadOp, len(list))
-	if len(list) > GOPROCESSES*2 && GOPROCESSES > 1 {
-		var wg sync.WaitGroup
-		wg.Add(GOPROCESSES)
-		groupSize := len(list)/GOPROCESSES + 1
-
-		for i := 0; i < GOPROCESSES; i++ {
-			grp := list[(i * groupSize) : (i+1)*groupSize]
-			go func(lst []string) {
-				ops := read(lst)
-				for _, op := range ops {
-					readOps <- op
-				}
-				wg.Done()
-			}(grp)
-		}
+// interruptible is done at the first ctrl-c or SIGTERM, so the run can stop cleanly: no more
+// renames or writes are started, and those under way are finished. a second one kills gfrn
+func interruptible() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Fprintln(os.Stderr, "Stopping, ctrl-c again to quit now")
+	}()
+	return ctx
+}
 
-		wg.Wait()
-		close(readOps)
+// stdin is shared by the prompts, so what one reads ahead isn't lost to the next
+var stdin = bufio.NewReader(os.Stdin)
 
-		a := []ReadOp{}
-		for r := range readOps {
-			a = append(a, r)
-		}
+// prompts is where the prompts are written, stderr when stdout is for -report json
+var prompts io.Writer = os.Stdout
 
-		return a
-	} else { // just add all to first
-		ops := read(list)
-		return ops
+// ask puts each rename and rewrite to whoever's at stdin for -interactive. running out of
+// input quits
+func ask(c gfrn.Change) gfrn.Answer {
+	if c.Rename != nil {
+		fmt.Fprintln(prompts, "rename", c.Rename.Old, "->", filepath.Base(c.Rename.New))
+	} else {
+		fmt.Fprint(prompts, "change ", c.Path, "\n", c.Diff)
 	}
-}
 
-func read(list []string) []ReadOp {
-	readOps := []ReadOp{}
-	for _, path := range list {
-		if path == "" {
-			continue
+	for {
+		fmt.Fprint(prompts, "[y]es, [n]o, [a]ll, [q]uit? ")
+		answer, err := stdin.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return gfrn.Yes
+		case "n", "no":
+			return gfrn.No
+		case "a", "all":
+			return gfrn.All
+		case "q", "quit":
+			return gfrn.Quit
 		}
-		bytes, err := os.ReadFile(path)
 		if err != nil {
-			fmt.Println("Got error reading file", path)
-			continue
+			fmt.Fprintln(prompts)
+			return gfrn.Quit
 		}
-
-		readOps = append(readOps, ReadOp{Path: path, Contents: bytes})
 	}
-
-	return readOps
 }
 
-func brokerUpdate(list []ReadOp, reg *regexp.Regexp, replace string) []WriteOp {
-	writeOps := make(chan WriteOp, len(list))
-	if len(list) > GOPROCESSES*2 && GOPROCESSES > 1 {
-		var wg sync.WaitGroup
-		wg.Add(GOPROCESSES)
-		groupSize := len(list)/GOPROCESSES + 1
-
-		for i := 0; i < GOPROCESSES; i++ {
-			grp := list[(i * groupSize) : (i+1)*groupSize]
-			go func(lst []ReadOp, reg *regexp.Regexp, replace string) {
-				ops := update(lst, reg, replace)
-				for _, op := range ops {
-					writeOps <- op
-				}
-				wg.Done()
-			}(grp, reg, replace)
-		}
+// confirm asks at the terminal whether to rewrite quarantined files, and says no when
+// there's nobody there to ask
+func confirm(suspects []gfrn.Suspect) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
 
-		wg.Wait()
-		close(writeOps)
+	fmt.Fprintf(prompts, "Rewrite the files with these %d matches anyway? [y/N] ", len(suspects))
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
 
-		a := []WriteOp{}
-		for r := range writeOps {
-			a = append(a, r)
-		}
+// parseSampleRate reads a percentage like "1%" or "0.5" (also a percentage) as a fraction
+func parseSampleRate(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
 
-		return a
-	} else { // just add all to first
-		ops := update(list, reg, replace)
-		return ops
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		return 0, fmt.Errorf("sample must be a percentage between 0 and 100, got %q", s)
 	}
+	return pct / 100, nil
 }
 
-func update(list []ReadOp, reg *regexp.Regexp, replace string) []WriteOp {
-	writes := []WriteOp{}
-	for _, read := range list {
-		matches := reg.FindAllSubmatch(read.Contents, 1)
+// parseMode reads an octal permission mode like 0644, blank being no mode
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
 
-		if len(matches) > 0 {
-			f := string(matches[0][1])
-			replaced := strings.Replace(string(read.Contents), f, replace, -1)
-			write := WriteOp{Path: read.Path, Contents: []byte(replaced)}
-			writes = append(writes, write)
-		}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v == 0 || v > 0777 {
+		return 0, fmt.Errorf("chmod must be an octal permission mode like 0644, got %q", s)
 	}
-	return writes
+	return os.FileMode(v), nil
 }
 
-func brokerWrite(list []WriteOp) {
-	if len(list) > GOPROCESSES*2 && GOPROCESSES > 1 {
-		var wg sync.WaitGroup
-		wg.Add(GOPROCESSES)
-		groupSize := len(list)/GOPROCESSES + 1
-
-		for i := 0; i < GOPROCESSES; i++ {
-			grp := list[(i * groupSize) : (i+1)*groupSize]
-			go func(lst []WriteOp) {
-				write(lst)
-				wg.Done()
-			}(grp)
+// splitList splits a csv flag value, dropping blanks
+func splitList(str string) []string {
+	list := []string{}
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			list = append(list, s)
 		}
-
-		wg.Wait()
-	} else {
-		write(list)
 	}
+	return list
 }
 
-func write(list []WriteOp) {
-	for _, wr := range list {
-		var err error
-		err = os.Remove(wr.Path)
-		if err != nil {
-			fmt.Println("Couldn't remove path", wr.Path, err)
-		}
-
-		err = os.WriteFile(wr.Path, wr.Contents, os.ModePerm)
-		if err != nil {
-			fmt.Println("Got error writing file", wr.Path, err)
-		}
+// lowerPriority sets gfrn's own cpu and io priority before it starts, false when they're
+// not valid or couldn't be set
+func lowerPriority(nice int, ioPriority string) bool {
+	if nice < -20 || nice > 19 {
+		fmt.Println("nice must be from -20 to 19")
+		return false
+	}
+	if ioPriority != "" && ioPriority != "idle" && ioPriority != "low" && ioPriority != "normal" {
+		fmt.Println("io-priority must be idle, low or normal")
+		return false
 	}
-}
 
-func splitToMap(str, split, prefix string) map[string]bool {
-	sp := strings.Split(str, split)
-	m := make(map[string]bool, len(sp))
-	for _, s := range sp {
-		ls := strings.ToLower(s)
-		ls = prefix + ls
-		m[ls] = true
+	err := setPriority(nice, ioPriority)
+	if err != nil {
+		fmt.Println("Couldn't set priority", err)
+		return false
 	}
-	return m
+	return true
 }
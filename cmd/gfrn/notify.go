@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// notifyDesktop pops up a desktop notification: a toast on windows, notification center
+// on macos, and through notify-send (libnotify) elsewhere
+func notifyDesktop(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $t.GetElementsByTagName('text')
+$text[0].AppendChild($t.CreateTextNode(` + quote(title) + `)) > $null
+$text[1].AppendChild($t.CreateTextNode(` + quote(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('gfrn').Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	case "darwin":
+		quote := func(s string) string { return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"` }
+		cmd = exec.Command("osascript", "-e", "display notification "+quote(message)+" with title "+quote(title))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=gfrn", title, message)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jasontconnell/gfrn"
+)
+
+// pairsFlag collects old=new pairs from a flag given any number of times
+type pairsFlag [][2]string
+
+func (p *pairsFlag) String() string {
+	list := []string{}
+	for _, pair := range *p {
+		list = append(list, pair[0]+"="+pair[1])
+	}
+	return strings.Join(list, ",")
+}
+
+func (p *pairsFlag) Set(s string) error {
+	pair, err := gfrn.ParsePair(s, "=")
+	if err != nil {
+		return err
+	}
+	*p = append(*p, pair)
+	return nil
+}
+
+// sidecarsFlag collects groups of suffixes from a flag given any number of times
+type sidecarsFlag [][]string
+
+func (s *sidecarsFlag) String() string {
+	list := []string{}
+	for _, group := range *s {
+		list = append(list, strings.Join(group, ","))
+	}
+	return strings.Join(list, " ")
+}
+
+func (s *sidecarsFlag) Set(v string) error {
+	group := splitList(v)
+	if len(group) < 2 {
+		return fmt.Errorf("%q needs at least two suffixes", v)
+	}
+	*s = append(*s, group)
+	return nil
+}
+
+// sizeFlag is a number of bytes, given as is or with a KB, MB or GB suffix
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeFlag) Set(v string) error {
+	units := map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "B": 1}
+	num, mult := strings.ToUpper(strings.TrimSpace(v)), int64(1)
+	for _, unit := range []string{"KB", "MB", "GB", "K", "M", "G", "B"} {
+		if strings.HasSuffix(num, unit) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(num, unit)), units[unit]
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q isn't a size, like 500KB or 10MB", v)
+	}
+	*s = sizeFlag(n * mult)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// linux io priorities are a class and a level within it, lower levels first
+const (
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioWhoProcess = 1
+)
+
+var ioPriorities = map[string]int{
+	"idle":   ioprioClassIdle << ioprioClassShift,
+	"low":    ioprioClassBE<<ioprioClassShift | 7,
+	"normal": ioprioClassBE<<ioprioClassShift | 4,
+}
+
+// setPriority sets the nice value and io priority of every thread gfrn has. linux keeps
+// both per thread, and threads started later take them from the one starting them
+func setPriority(nice int, ioPriority string) error {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		if nice != 0 {
+			err = unix.Setpriority(unix.PRIO_PROCESS, tid, nice)
+			if err != nil {
+				return err
+			}
+		}
+
+		if ioPriority != "" {
+			_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioPriorities[ioPriority]))
+			if errno != 0 {
+				return errno
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func setPriority(nice int, ioPriority string) error {
+	if nice != 0 || ioPriority != "" {
+		return fmt.Errorf("-nice and -io-priority aren't supported on %v", runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// setPriority sets gfrn's nice value. there's no io priority to set here
+func setPriority(nice int, ioPriority string) error {
+	if ioPriority != "" {
+		return fmt.Errorf("-io-priority isn't supported on %v", runtime.GOOS)
+	}
+	if nice == 0 {
+		return nil
+	}
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, nice)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// setPriority maps a nice value onto windows' priority classes, 10 and up being idle. any
+// io priority other than normal puts gfrn in background mode, which lowers its disk and
+// memory priority along with its cpu priority
+func setPriority(nice int, ioPriority string) error {
+	class := uint32(0)
+	switch {
+	case nice >= 10:
+		class = windows.IDLE_PRIORITY_CLASS
+	case nice > 0:
+		class = windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice < -10:
+		class = windows.HIGH_PRIORITY_CLASS
+	case nice < 0:
+		class = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	}
+	if class != 0 {
+		err := windows.SetPriorityClass(windows.CurrentProcess(), class)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ioPriority == "idle" || ioPriority == "low" {
+		return windows.SetPriorityClass(windows.CurrentProcess(), windows.PROCESS_MODE_BACKGROUND_BEGIN)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jasontconnell/gfrn"
+	"golang.org/x/term"
+)
+
+const (
+	meterRedraw = 100 * time.Millisecond // how often the line on a terminal is redrawn, at most
+	meterEvery  = 10 * time.Second       // how often a line is logged otherwise
+)
+
+// meter shows how far a run has got on out: a line kept up to date in place when out is a
+// terminal, or a line every meterEvery when it's a file or a pipe
+type meter struct {
+	mu    sync.Mutex
+	out   *os.File
+	tty   bool
+	p     gfrn.Progress
+	start time.Time // of the phase
+	last  time.Time // when the progress was last shown
+	shown bool      // there's a line on the terminal to clear before anything else is written
+	held  bool      // the run's output stopped part way through a line, so none can be shown
+}
+
+// newMeter makes the meter for out. logged lines start meterEvery in, so a quick run has none
+func newMeter(out *os.File) *meter {
+	return &meter{out: out, tty: term.IsTerminal(int(out.Fd())), last: time.Now()}
+}
+
+// update is the run's Options.Progress
+func (m *meter) update(p gfrn.Progress) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if p.Phase != m.p.Phase {
+		m.start = now
+	}
+	m.p = p
+
+	if p.Phase == gfrn.PhaseDone {
+		m.clear()
+		return
+	}
+
+	every := meterEvery
+	if m.tty {
+		every = meterRedraw
+	}
+	if now.Sub(m.last) < every || m.held {
+		return
+	}
+	m.last = now
+	m.show()
+}
+
+func (m *meter) show() {
+	if m.tty {
+		fmt.Fprintf(m.out, "\r%s\033[K", m.text())
+		m.shown = true
+		return
+	}
+	fmt.Fprintln(m.out, m.text())
+}
+
+func (m *meter) clear() {
+	if m.shown {
+		fmt.Fprint(m.out, "\r\033[K")
+		m.shown = false
+	}
+}
+
+// text is the progress as a line, like
+// contents: 1200 walked, 800 read (35.2 MB), 12 written, 30 matches, 40s left
+func (m *meter) text() string {
+	p := m.p
+	switch p.Phase {
+	case gfrn.PhaseRename:
+		return fmt.Sprintf("rename: %d renamed", p.Renames)
+	case gfrn.PhaseFind:
+		return fmt.Sprintf("find: %d walked", p.Walked)
+	}
+
+	text := fmt.Sprintf("%s: %d walked, %d read (%.1f MB), %d written, %d matches", p.Phase, p.Walked, p.Scanned, float64(p.Bytes)/(1<<20), p.Changed, p.Matches)
+	if !p.WalkDone {
+		return text + ", still walking"
+	}
+	if p.Scanned > 0 && p.Scanned < p.Walked {
+		elapsed := time.Since(m.start)
+		left := time.Duration(float64(elapsed) * float64(p.Walked-p.Scanned) / float64(p.Scanned))
+		text += fmt.Sprintf(", %v left", left.Round(time.Second))
+	}
+	return text
+}
+
+// writer is w with the progress line taken off the terminal before anything's written
+// to it and put back after, so the two don't run into each other
+func (m *meter) writer(w io.Writer) io.Writer {
+	return meterWriter{m, w}
+}
+
+type meterWriter struct {
+	m *meter
+	w io.Writer
+}
+
+func (mw meterWriter) Write(b []byte) (int, error) {
+	if !mw.m.tty {
+		return mw.w.Write(b)
+	}
+
+	mw.m.mu.Lock()
+	defer mw.m.mu.Unlock()
+
+	shown := mw.m.shown || mw.m.held
+	mw.m.clear()
+	n, err := mw.w.Write(b)
+	mw.m.held = len(b) > 0 && b[len(b)-1] != '\n'
+	if shown && !mw.m.held && mw.m.p.Phase != gfrn.PhaseDone {
+		mw.m.show()
+	}
+	return n, err
+}
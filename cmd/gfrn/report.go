@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jasontconnell/gfrn"
+)
+
+// writeSummary writes sum to the file at path, or when fd is set, to that already open
+// descriptor, e.g. -report-fd 3 with 3>report.json
+func writeSummary(sum *gfrn.Report, path string, fd int) error {
+	b, err := summaryJSON(sum)
+	if err != nil {
+		return err
+	}
+
+	var f *os.File
+	if fd > 0 {
+		f = os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+		if f == nil {
+			return fmt.Errorf("fd %d isn't open", fd)
+		}
+	} else {
+		f, err = os.Create(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// summaryJSON is sum as indented json, with empty lists rather than nulls
+func summaryJSON(sum *gfrn.Report) ([]byte, error) {
+	if sum.Renames == nil {
+		sum.Renames = []gfrn.RenameOp{}
+	}
+	if sum.Files == nil {
+		sum.Files = []gfrn.ReportFile{}
+	}
+	if sum.Exts == nil {
+		sum.Exts = []*gfrn.ExtStats{}
+	}
+	if sum.Skipped == nil {
+		sum.Skipped = []gfrn.SkippedPath{}
+	}
+
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// summaryCSV is a row for each rename, each rewritten file and each skipped one, for a spreadsheet
+func summaryCSV(sum *gfrn.Report) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"change", "path", "new path", "matches", "reason"})
+	for _, rn := range sum.Renames {
+		w.Write([]string{"rename", rn.Old, rn.New, "", ""})
+	}
+	for _, f := range sum.Files {
+		w.Write([]string{"contents", f.Path, "", strconv.Itoa(f.Matches), ""})
+	}
+	for _, s := range sum.Skipped {
+		w.Write([]string{"skipped", s.Path, "", "", s.Reason})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// printTotals is the summary at the end of a run. a dry run's are what it would have done
+func printTotals(w io.Writer, sum *gfrn.Report, dry bool) {
+	t := sum.Totals
+	if dry {
+		fmt.Fprintf(w, "Scanned %d files, %d would change\n", t.Scanned, t.Matched)
+		fmt.Fprintf(w, "Would rename %d directories and %d files, and make %d replacements\n", t.DirsRenamed, t.FilesRenamed, t.Replacements)
+	} else {
+		fmt.Fprintf(w, "Scanned %d files, %d matched, %d changed, %s written\n", t.Scanned, t.Matched, t.Changed, sizeText(t.BytesWritten))
+		fmt.Fprintf(w, "Renamed %d directories and %d files, made %d replacements\n", t.DirsRenamed, t.FilesRenamed, t.Replacements)
+	}
+	if t.Failed > 0 {
+		fmt.Fprintf(w, "Failed on %d files, the report lists them as skipped\n", t.Failed)
+	}
+
+	phases := []string{}
+	for _, p := range t.Phases {
+		d, err := time.ParseDuration(p.Elapsed)
+		if err == nil {
+			if d > time.Millisecond {
+				d = d.Round(time.Millisecond)
+			}
+			phases = append(phases, fmt.Sprintf("%s %v", p.Phase, d.Round(time.Microsecond)))
+		}
+	}
+	if len(phases) > 0 {
+		fmt.Fprintln(w, "Took", strings.Join(phases, ", "))
+	}
+}
+
+// sizeText is n bytes in bytes, KB or MB, whichever reads best
+func sizeText(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d bytes", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
@@ -0,0 +1,96 @@
+package gfrn
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// caseCollisions finds names that, once renames are applied, would share a directory with
+// another name differing only by case. those collide on windows and macos checkouts even
+// when the run itself happens on a case sensitive filesystem
+func caseCollisions(renames []RenameOp) [][]string {
+	renamed := make(map[string]string, len(renames))
+	parents := []string{}
+	seen := map[string]bool{}
+	for _, rn := range renames {
+		renamed[rn.Old] = filepath.Base(rn.New)
+		parent := filepath.Dir(rn.Old)
+		if !seen[parent] {
+			seen[parent] = true
+			parents = append(parents, parent)
+		}
+	}
+
+	collisions := [][]string{}
+	for _, parent := range parents {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			continue
+		}
+
+		groups := map[string][]string{}
+		for _, e := range entries {
+			name := e.Name()
+			if n, ok := renamed[filepath.Join(parent, name)]; ok {
+				name = n
+			}
+			lname := strings.ToLower(name)
+			if !containsString(groups[lname], name) {
+				groups[lname] = append(groups[lname], name)
+			}
+		}
+
+		keys := []string{}
+		for k, names := range groups {
+			if len(names) > 1 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			paths := []string{}
+			for _, name := range groups[k] {
+				paths = append(paths, filepath.Join(parent, name))
+			}
+			collisions = append(collisions, paths)
+		}
+	}
+	return collisions
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var windowsDevices = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// unsafeNames finds renames to names windows reserves for devices (CON, NUL.txt, COM1...)
+// or that end in a dot or space. they can be created, but explorer and most tools can't
+// then open or delete them
+func unsafeNames(renames []RenameOp) []RenameOp {
+	list := []RenameOp{}
+	for _, rn := range renames {
+		name := filepath.Base(rn.New)
+		stem := name
+		if i := strings.Index(stem, "."); i != -1 {
+			stem = stem[:i]
+		}
+
+		if windowsDevices[strings.ToUpper(strings.TrimRight(stem, " "))] || strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			list = append(list, rn)
+		}
+	}
+	return list
+}
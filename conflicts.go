@@ -0,0 +1,160 @@
+package gfrn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// conflict is a rename that can't go ahead as it is, because another rename has the same
+// target, or something is already there that isn't moved out of the way first
+type conflict struct {
+	i     int    // index of the rename
+	other string // the other rename's source, "" when the target already exists
+}
+
+func (c conflict) describe(renames []RenameOp) string {
+	rn := renames[c.i]
+	if c.other != "" {
+		return rn.Old + " and " + c.other + " would both be renamed to " + rn.New
+	}
+	return rn.Old + " would be renamed onto " + rn.New + ", which already exists"
+}
+
+func (c conflict) export(renames []RenameOp) RenameConflict {
+	return RenameConflict{Old: renames[c.i].Old, New: renames[c.i].New, Other: c.other}
+}
+
+// findConflicts checks renames against each other and against what's on disk
+func findConflicts(renames []RenameOp) []conflict {
+	sources := make(map[string]int, len(renames))
+	for i, rn := range renames {
+		sources[rn.Old] = i
+	}
+
+	list := []conflict{}
+	targets := map[string]int{}
+	for i, rn := range renames {
+		if j, ok := targets[rn.New]; ok {
+			list = append(list, conflict{i: i, other: renames[j].Old})
+			continue
+		}
+		targets[rn.New] = i
+
+		if targetTaken(renames, sources, i) {
+			list = append(list, conflict{i: i})
+		}
+	}
+	return list
+}
+
+// targetTaken is true when something is at the target of renames[i] when it runs. renames
+// run last to first, so whatever is there and renamed further down the list has moved
+func targetTaken(renames []RenameOp, sources map[string]int, i int) bool {
+	rn := renames[i]
+	info, err := os.Lstat(rn.New)
+	if err != nil {
+		return false
+	}
+	if j, ok := sources[rn.New]; ok && j > i {
+		return false
+	}
+
+	// a case only rename on a case insensitive filesystem finds the file itself
+	if old, err := os.Lstat(rn.Old); err == nil && os.SameFile(info, old) {
+		return false
+	}
+	return true
+}
+
+// resolveConflicts deals with conflicting renames the way onConflict says: fail lists them
+// and stops the run, skip leaves them out, suffix numbers their new names until they're
+// free (name-2.txt), and overwrite renames files over files already there. renames onto
+// another rename's target, or to or from a directory, can't be overwritten
+func (e *Engine) resolveConflicts(renames []RenameOp, onConflict string) ([]RenameOp, error) {
+	conflicts := findConflicts(renames)
+	if len(conflicts) == 0 {
+		return renames, nil
+	}
+
+	switch onConflict {
+	case "skip":
+		skipped := map[int]bool{}
+		for _, c := range conflicts {
+			e.console.println("Skipping rename,", c.describe(renames))
+			e.skips.add(renames[c.i].Old, c.describe(renames))
+			skipped[c.i] = true
+		}
+
+		list := []RenameOp{}
+		for i, rn := range renames {
+			if !skipped[i] {
+				list = append(list, rn)
+			}
+		}
+		return list, nil
+
+	case "suffix":
+		taken := map[string]bool{}
+		for _, rn := range renames {
+			taken[rn.New] = true
+		}
+
+		list := append([]RenameOp{}, renames...)
+		for _, c := range conflicts {
+			list[c.i].New = freeName(renames[c.i].New, taken)
+			e.console.println("Renaming", renames[c.i].Old, "to", filepath.Base(list[c.i].New)+",", c.describe(renames))
+		}
+		return list, nil
+
+	case "overwrite":
+		unsettled := []RenameConflict{}
+		for _, c := range conflicts {
+			rn := renames[c.i]
+			if c.other != "" || rn.Dir || isDir(rn.New) {
+				e.console.println("Can't overwrite,", c.describe(renames))
+				unsettled = append(unsettled, c.export(renames))
+				continue
+			}
+			e.console.println("Overwriting", rn.New, "with", rn.Old)
+		}
+		if len(unsettled) > 0 {
+			return renames, &RenameCollisionError{Conflicts: unsettled, OnConflict: onConflict}
+		}
+		return renames, nil
+	}
+
+	list := []RenameConflict{}
+	for _, c := range conflicts {
+		e.console.println("Conflict:", c.describe(renames))
+		list = append(list, c.export(renames))
+	}
+	return renames, &RenameCollisionError{Conflicts: list, OnConflict: onConflict}
+}
+
+func validOnConflict(onConflict string) error {
+	if onConflict != "" && onConflict != "fail" && onConflict != "skip" && onConflict != "suffix" && onConflict != "overwrite" {
+		return fmt.Errorf("on-conflict must be fail, skip, suffix or overwrite, not %v", onConflict)
+	}
+	return nil
+}
+
+// freeName numbers path, before its extension, until it's neither taken nor on disk
+func freeName(path string, taken map[string]bool) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		p := stem + "-" + strconv.Itoa(n) + ext
+		if _, err := os.Lstat(p); err != nil && !taken[p] {
+			taken[p] = true
+			return p
+		}
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
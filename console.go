@@ -0,0 +1,86 @@
+package gfrn
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+type consoleMsg struct {
+	text    string
+	flushed chan struct{}
+}
+
+// consoleWriter is where everything a run prints goes. the read, update and write workers
+// all report as they go, so output is handed to a single goroutine that writes it in order,
+// and a line from one worker can never land in the middle of another's
+type consoleWriter struct {
+	msgs chan consoleMsg
+	w    io.Writer
+	done chan struct{} // closed once the goroutine has written everything and stopped
+
+	// what's printed after close, by an update abandoned for taking too long, is dropped
+	mu     sync.Mutex
+	closed bool
+}
+
+func newConsoleWriter(w io.Writer, size int) *consoleWriter {
+	c := &consoleWriter{msgs: make(chan consoleMsg, size), w: w, done: make(chan struct{})}
+
+	go func() {
+		defer close(c.done)
+		for msg := range c.msgs {
+			if msg.flushed != nil {
+				close(msg.flushed)
+				continue
+			}
+			io.WriteString(c.w, msg.text)
+		}
+	}()
+
+	return c
+}
+
+func (c *consoleWriter) send(msg consoleMsg) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.msgs <- msg
+	return true
+}
+
+func (c *consoleWriter) println(a ...interface{}) {
+	c.send(consoleMsg{text: fmt.Sprintln(a...)})
+}
+
+func (c *consoleWriter) printf(format string, a ...interface{}) {
+	c.send(consoleMsg{text: fmt.Sprintf(format, a...)})
+}
+
+// Write lets whole blocks, like a flushed tabwriter, go out in one piece
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.send(consoleMsg{text: string(p)})
+	return len(p), nil
+}
+
+// flush waits for everything printed so far to be written, for before something else
+// writes to stdout directly, like a pager or a child process, or the program exits
+func (c *consoleWriter) flush() {
+	done := make(chan struct{})
+	if c.send(consoleMsg{flushed: done}) {
+		<-done
+	}
+}
+
+// close writes everything printed so far and stops the goroutine, at the end of a run
+func (c *consoleWriter) close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.msgs)
+	}
+	c.mu.Unlock()
+	<-c.done
+}
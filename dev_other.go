@@ -0,0 +1,27 @@
+//go:build !unix
+
+package gfrn
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// deviceOf can't tell devices apart here, so -xdev has no effect
+func deviceOf(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// linksOf can't see inodes here, so hardlinks are processed like separate files
+func linksOf(info fs.FileInfo) (fileID, uint64, bool) {
+	return fileID{}, 0, false
+}
+
+func ownerOf(info fs.FileInfo) (string, bool) {
+	return "", false
+}
+
+// lookupOwner fails, files here don't have a single owning uid to go by
+func lookupOwner(name string) (string, error) {
+	return "", fmt.Errorf("-owner only works on unix")
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package gfrn
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// deviceOf returns the id of the device a file lives on
+func deviceOf(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// linksOf returns the id of a file and how many hardlinks it has
+func linksOf(info fs.FileInfo) (fileID, uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, 0, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, uint64(st.Nlink), true
+}
+
+// ownerOf returns the uid of the user that owns a file
+func ownerOf(info fs.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(st.Uid), 10), true
+}
+
+// lookupOwner returns the uid of a user given by name or by uid
+func lookupOwner(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, nerr := strconv.ParseUint(name, 10, 32); nerr != nil {
+			return "", err
+		}
+		u, err = user.LookupId(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	return u.Uid, nil
+}
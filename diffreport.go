@@ -0,0 +1,60 @@
+package gfrn
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// DiffReport finds what still contains the pattern since the run old reports on: files
+// that weren't among those it changed, and files it changed that contain it again. Dir and
+// Find default to old's, Dir to where the run renamed it
+func (e *Engine) DiffReport(ctx context.Context, old Report, opts Options) ([]ReportFile, error) {
+	done := e.begin(opts)
+	defer done()
+
+	if opts.Dir == "" {
+		opts.Dir = old.Dir
+		for _, rn := range old.Renames {
+			if rn.Old == old.Dir {
+				opts.Dir = rn.New
+			}
+		}
+	}
+	if opts.Find == "" && len(opts.Pairs) == 0 {
+		opts.Find = old.Find
+	}
+
+	s, err := prepare(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, f := range old.Files {
+		changed[f.Path] = true
+	}
+
+	e.progress.phase(PhaseCheck)
+	found := []ReportFile{}
+	for rd := range e.streamRead(e.walkTextFiles(opts.Dir, s.wf), s.wf, false) {
+		if n := len(s.m.findAll(rd.Contents)); n > 0 {
+			found = append(found, ReportFile{Path: rd.Path, Matches: n})
+		}
+	}
+	sortByPath(found, func(i int) string { return found[i].Path })
+
+	group := ""
+	for _, f := range found {
+		if d := filepath.Dir(f.Path); d != group {
+			group = d
+			e.console.println(group)
+		}
+		if changed[f.Path] {
+			e.console.println("  again", filepath.Base(f.Path), f.Matches, "matches")
+		} else {
+			e.console.println("  new  ", filepath.Base(f.Path), f.Matches, "matches")
+		}
+	}
+	e.console.println(len(found), "files contain", opts.Find, "since the run in", old.Dir)
+	return found, nil
+}
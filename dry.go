@@ -0,0 +1,93 @@
+package gfrn
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dryRun goes through the whole run, renames and content pass, printing every rename and
+// every file whose contents would change, without changing anything, then what about it
+// looks risky
+func (e *Engine) dryRun(dir, replace string, renames []RenameOp, m matcher, budget time.Duration, wf *walkFilter, sum *Report) {
+	for _, rn := range renames {
+		e.console.println("rename", rn.Old, "->", rn.New)
+	}
+
+	e.progress.phase(PhaseContents)
+	e.tally.reset()
+	reads := e.brokerRead(e.walkTextFiles(dir, wf), wf, false)
+	writes := e.brokerUpdate(reads, m, replace, budget)
+
+	// streamed files are only counted, they have no contents to check
+	all := append([]WriteOp{}, writes...)
+	for _, path := range wf.takeLarge() {
+		reads = append(reads, ReadOp{Path: path})
+		scan, err := scanStream(path, m, replace, wf, false, false)
+		if err != nil {
+			e.console.println("Couldn't stream", path, err)
+			continue
+		}
+		if scan.matches > 0 {
+			e.tally.matched.Add(1)
+			all = append(all, WriteOp{Path: path, Matches: scan.matches, Rules: scan.rules})
+		}
+	}
+	sortByPath(all, func(i int) string { return all[i].Path })
+
+	group := ""
+	for _, wr := range all {
+		if d := filepath.Dir(wr.Path); d != group {
+			group = d
+			e.console.println(group)
+		}
+		e.console.println("  change", filepath.Base(wr.Path), wr.Matches, "matches")
+	}
+
+	sum.addWrites(all)
+	sum.Exts = statsByExt(reads, all)
+
+	e.printSafety(renames, writes, wf)
+
+	e.console.println(len(renames), "renames and", len(all), "files would change, nothing was changed")
+}
+
+// printSafety lists what would make the run a bad idea: renames onto names already taken,
+// names that would differ only by case, renames that only change case, names that would
+// become ignored, and files the replacement would leave empty
+func (e *Engine) printSafety(renames []RenameOp, writes []WriteOp, wf *walkFilter) {
+	lines := []string{}
+
+	for _, c := range findConflicts(renames) {
+		lines = append(lines, "collision    "+c.describe(renames))
+	}
+
+	for _, c := range caseCollisions(renames) {
+		lines = append(lines, "case         names would differ only by case: "+strings.Join(c, ", "))
+	}
+
+	for _, rn := range renames {
+		if strings.EqualFold(filepath.Base(rn.Old), filepath.Base(rn.New)) {
+			lines = append(lines, "case only    "+rn.Old+" -> "+filepath.Base(rn.New))
+		}
+		if wf.ignoredName(filepath.Base(rn.New)) {
+			lines = append(lines, "ignored      "+rn.Old+" would be renamed to "+filepath.Base(rn.New)+", which is ignored")
+		}
+	}
+
+	for _, wr := range writes {
+		if len(wr.Contents) == 0 {
+			lines = append(lines, "empty        "+wr.Path+" would be left with nothing in it")
+		}
+	}
+
+	if len(lines) == 0 {
+		e.console.println("Safety: nothing risky found")
+		return
+	}
+
+	e.console.println("Safety:")
+	for _, line := range lines {
+		e.console.println("  " + line)
+	}
+}
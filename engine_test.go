@@ -0,0 +1,42 @@
+package gfrn
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// an Engine leaves nothing running once its runs are done, so a program can make as many
+// as it likes
+func TestEnginesDontLeak(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("Alpha\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		opts := DefaultOptions()
+		opts.Dir, opts.Exts, opts.Find, opts.Replace = dir, []string{".txt"}, "Alpha", "Alpha"
+		e := Engine{Output: io.Discard}
+		if _, err := e.Run(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// goroutines that have been told to stop can take a moment to be gone
+	for wait := time.Millisecond; ; wait *= 2 {
+		n := runtime.NumGoroutine()
+		if n <= before {
+			return
+		}
+		if wait > time.Second {
+			t.Fatalf("%d goroutines before the runs, %d after", before, n)
+		}
+		time.Sleep(wait)
+	}
+}
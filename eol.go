@@ -0,0 +1,77 @@
+package gfrn
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// utf8BOM is how a bom reads once contents are utf-8, whatever they were encoded in
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// cutBOM splits a leading bom off b, so ^ matches where the text starts and no
+// replacement can take the bom away
+func cutBOM(b []byte) ([]byte, []byte) {
+	if bytes.HasPrefix(b, utf8BOM) {
+		return utf8BOM, b[len(utf8BOM):]
+	}
+	return nil, b
+}
+
+// lineEnding is crlf when every line of b ends in one, lf when none do, and "" for a mix
+// of them or no lines at all
+func lineEnding(b []byte) string {
+	lf := bytes.Count(b, []byte("\n"))
+	if lf == 0 {
+		return ""
+	}
+
+	switch bytes.Count(b, []byte("\r\n")) {
+	case lf:
+		return "\r\n"
+	case 0:
+		return "\n"
+	}
+	return ""
+}
+
+// keepLineEnding gives lines the replacement brought into after the line ending the rest of
+// before has, so a replacement with a newline in it doesn't leave a crlf file mixed.
+// files that were mixed already are left as they are
+func keepLineEnding(before, after []byte) []byte {
+	eol := lineEnding(before)
+	if eol == "" || lineEnding(after) == eol {
+		return after
+	}
+	return setLineEnding(after, eol)
+}
+
+// setLineEnding ends every line of b with eol
+func setLineEnding(b []byte, eol string) []byte {
+	lf := bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	if eol == "\n" {
+		return lf
+	}
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte(eol))
+}
+
+// withLineEnding is setLineEnding for the file at path when there's an eol to set.
+// shortcuts are binary, so they're left as they are
+func withLineEnding(path string, b []byte, eol string) []byte {
+	if eol == "" || isShortcut(path) {
+		return b
+	}
+	return setLineEnding(b, eol)
+}
+
+// eolOf is the line ending the -eol option names, "" to keep each file's own
+func eolOf(name string) (string, error) {
+	switch name {
+	case "", "keep":
+		return "", nil
+	case "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	}
+	return "", fmt.Errorf("eol must be lf, crlf or keep, not %v", name)
+}
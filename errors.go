@@ -0,0 +1,158 @@
+package gfrn
+
+import (
+	"fmt"
+	"time"
+)
+
+// the errors a run can stop with, or skip a path for, that embedders may want to handle
+// differently from each other: retry a locked tree later, skip a file that can't be
+// encoded, abort on collisions. errors.As finds them in what Run returns, and in the Err
+// of each SkippedPath
+
+// RenameConflict is a rename onto another rename's target, Other being that rename's
+// source, or onto something already there when Other is ""
+type RenameConflict struct {
+	Old   string `json:"old"`
+	New   string `json:"new"`
+	Other string `json:"other,omitempty"`
+}
+
+// RenameCollisionError is renames that conflict, so nothing was renamed. OnConflict is
+// how they were to be dealt with, overwrite when they were ones it can't overwrite
+type RenameCollisionError struct {
+	Conflicts  []RenameConflict
+	OnConflict string
+}
+
+func (e *RenameCollisionError) Error() string {
+	if e.OnConflict == "overwrite" {
+		return fmt.Sprintf("%d renames conflict in ways -on-conflict overwrite can't settle, nothing was renamed", len(e.Conflicts))
+	}
+	return fmt.Sprintf("%d renames conflict, nothing was renamed. -on-conflict can skip, suffix or overwrite them", len(e.Conflicts))
+}
+
+// CaseCollisionError is renames that would leave names differing only by case, with
+// -case-collision fail. Names are the sets of them
+type CaseCollisionError struct {
+	Names [][]string
+}
+
+func (e *CaseCollisionError) Error() string {
+	return fmt.Sprintf("%d sets of names would differ only by case, nothing was renamed", len(e.Names))
+}
+
+// ReservedNameError is renames to names Windows can't use, so nothing was renamed
+type ReservedNameError struct {
+	Renames []RenameOp
+}
+
+func (e *ReservedNameError) Error() string {
+	return fmt.Sprintf("%d renames would make names reserved on Windows, nothing was renamed", len(e.Renames))
+}
+
+// RenameError is a rename that failed part way through the renames, the ones before it
+// having been made
+type RenameError struct {
+	Old, New string
+	Err      error
+}
+
+func (e *RenameError) Error() string {
+	return fmt.Sprintf("Couldn't rename %v to %v, %s", e.Old, e.New, e.Err)
+}
+
+func (e *RenameError) Unwrap() error { return e.Err }
+
+// RunLockedError is a tree whose run lock another run holds. when Stale, that run is
+// gone, and Options.Takeover removes its lock
+type RunLockedError struct {
+	Dir     string
+	Path    string // the lock file
+	PID     int
+	Host    string
+	Started time.Time
+	Idle    time.Duration // since its run last touched it
+	Stale   bool
+}
+
+func (e *RunLockedError) Error() string {
+	if e.Stale {
+		return fmt.Sprintf("%v is locked by gfrn pid %d on %v, which is gone without unlocking it, its last heartbeat %v ago. -takeover removes the lock and its temp files", e.Dir, e.PID, e.Host, e.Idle.Round(time.Second))
+	}
+	return fmt.Sprintf("%v is being changed by gfrn pid %d on %v, running since %v", e.Dir, e.PID, e.Host, e.Started.Format(time.RFC3339))
+}
+
+// EncodingError is a file whose new contents can't be encoded back to its charset,
+// because the replacement has characters the charset doesn't
+type EncodingError struct {
+	Path    string
+	Charset string
+	Err     error
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("Couldn't encode %v back to %v, %s", e.Path, e.Charset, e.Err)
+}
+
+func (e *EncodingError) Unwrap() error { return e.Err }
+
+// TimeoutError is a file that took longer than Options.FileTimeout to replace in
+type TimeoutError struct {
+	Path  string
+	After time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v took longer than %v", e.Path, e.After)
+}
+
+// LimitError is a run that would have gone over MaxTotal replacements, when Limit is
+// max-total, or had more than MaxPerDir files change in Over directories, when Limit is
+// max-per-dir. nothing was changed
+type LimitError struct {
+	Limit string
+	Max   int
+	Found int // replacements for max-total
+	Over  []string
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == "max-per-dir" {
+		return fmt.Sprintf("%d directories would have more than -max-per-dir %d files changed, nothing was changed", len(e.Over), e.Max)
+	}
+	return fmt.Sprintf("%d replacements would be made, more than -max-total %d, nothing was changed", e.Found, e.Max)
+}
+
+// AccessError is paths Options.Precheck found the run can't read or write
+type AccessError struct {
+	Problems []AccessProblem
+}
+
+// AccessProblem is a path and what can't be done to it
+type AccessProblem struct {
+	Path string
+	What string // can't read or can't write
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("%d paths can't be read or written, fix their permissions or use -skip-unreadable, nothing was changed", len(e.Problems))
+}
+
+// StoppedError is a run that stopped part way because its context was done, after
+// making Renames renames, out of Of when it stopped among them, and changing Files files
+type StoppedError struct {
+	Renames int
+	Of      int
+	Files   int
+	Err     error
+}
+
+func (e *StoppedError) Error() string {
+	if e.Of > 0 {
+		return fmt.Sprintf("Stopped after %d of %d renames, %s", e.Renames, e.Of, e.Err)
+	}
+	return fmt.Sprintf("Stopped after %d renames and %d file changes, files not reached yet were left alone, %s", e.Renames, e.Files, e.Err)
+}
+
+func (e *StoppedError) Unwrap() error { return e.Err }
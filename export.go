@@ -0,0 +1,86 @@
+package gfrn
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// exportChanged writes the files a run renamed or rewrote, as they are after it, to a
+// gzipped tar at path with paths relative to dir, so just the delta can be shipped
+// somewhere the whole tree can't be synced to
+func (e *Engine) exportChanged(path, dir string, renames []RenameOp, files []ReportFile) error {
+	changed := map[string]bool{}
+	renamed := renameMap(renames)
+	for _, rn := range renames {
+		if !rn.Dir {
+			changed[renamedPath(renamed, rn.Old)] = true
+		}
+	}
+	for _, sf := range files {
+		changed[sf.Path] = true
+	}
+
+	list := []string{}
+	for p := range changed {
+		list = append(list, p)
+	}
+	sortByPath(list, func(i int) string { return list[i] })
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for _, p := range list {
+		err = writeTarFile(tw, relSlash(dir, p), p)
+		if err != nil {
+			return fmt.Errorf("Couldn't archive %v, %s", p, err)
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	e.console.println("Exported", len(list), "changed files to", path)
+	return f.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(tw, src)
+	return err
+}
@@ -0,0 +1,71 @@
+package gfrn
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// frequencies counts every distinct spelling of the find pattern in names and in text file
+// contents, so a case insensitive pattern can be checked for catching just the variants
+// expected before anything is replaced
+func (e *Engine) frequencies(dir string, m matcher, wf *walkFilter) {
+	names, contents := map[string]int{}, map[string]int{}
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			e.console.println(err)
+			return err
+		}
+
+		if wf.skipDir(path, d) || wf.excludedPath(path) && d.IsDir() {
+			return filepath.SkipDir
+		}
+
+		if wf.excludedPath(path) || wf.ignoredFile(path, d) {
+			return nil
+		}
+
+		name := d.Name()
+		for _, loc := range m.findAll([]byte(name)) {
+			names[name[loc[0]:loc[1]]]++
+		}
+		return nil
+	})
+
+	for rd := range e.streamRead(e.walkTextFiles(dir, wf), wf, false) {
+		for _, loc := range m.findAll(rd.Contents) {
+			contents[string(rd.Contents[loc[0]:loc[1]])]++
+		}
+	}
+
+	e.printFrequencies("names", names)
+	e.printFrequencies("contents", contents)
+}
+
+func (e *Engine) printFrequencies(title string, counts map[string]int) {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	e.console.println("Matched in", title+":")
+	if len(keys) == 0 {
+		e.console.println("  nothing")
+		return
+	}
+
+	tw := tabwriter.NewWriter(e.console, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "  %s\t×%d\n", k, counts[k])
+	}
+	tw.Flush()
+}
@@ -0,0 +1,1295 @@
+// Package gfrn finds and replaces a string in the names and contents of everything under
+// a directory. cmd/gfrn is the command line front end to it
+package gfrn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Engine carries out runs, printing what they do to Output, or stdout when it's nil. an
+// Engine's runs are one at a time, separate Engines' can run at once
+type Engine struct {
+	Output io.Writer
+
+	mu       sync.Mutex
+	console  *consoleWriter // everything the run prints goes through this
+	workers  int            // each of the read, update and write stages has, from Options.Workers
+	skips    *skipLog       // what the workers skip, for the report
+	retries  *retryQueue    // files the content pass couldn't read or write, to try again
+	progress *tracker       // passes what the workers do on to Options.Progress
+	tally    *counts        // what the workers of the content pass do, for the totals
+}
+
+// Options are what a run finds, what it replaces it with, and how. DefaultOptions has
+// the command line's defaults
+type Options struct {
+	Dir, Find, Replace  string
+	Pairs               [][2]string // more finds and replaces, made in the same run
+	Ignore              []string    // names and patterns like *.snap, never renamed or searched
+	Exts                []string    // text file extensions, whose contents are replaced
+	CaseSensitive       bool
+	Snapshot            string
+	SampleRate          float64 // a fraction, not a percentage
+	SampleFiles         int
+	CaseCollision       string // warn or fail
+	OnConflict          string // fail, skip, suffix or overwrite, for renames onto taken names
+	RenameRoot          bool
+	RenameDirs          bool // rename directories whose names match
+	RenameFiles         bool // rename files whose names match
+	RenameContents      bool // replace in text files' contents
+	Freq                bool
+	Stats               bool // break the table by extension at the end down further
+	List                bool // only search, printing the paths and lines that match
+	Count               bool // only search, printing how many matches each path has
+	MaxTotal            int
+	MaxPerDir           int    // files changed in any one directory
+	MaxPerDirAction     string // warn or fail when a directory has more
+	Preview             int
+	Lock                bool
+	XDev                bool
+	ExcludeMime         []string
+	Mode                os.FileMode
+	EOL                 string // lf or crlf to give every rewritten file those line endings, "" or keep for their own
+	Fsync               bool
+	Atomic              bool
+	OnlyInMatchingFiles bool
+	ExcludeFiles        []string // relative to Dir
+	FileTimeout         time.Duration
+	Retries             int           // rounds of retrying files that failed to read or write, at the end of the content pass
+	RetryWait           time.Duration // before the first round, doubling each round after
+	History             bool
+	VCS                 bool
+	Semantic            bool
+	IfContains          string
+	Charset             string // blank leaves contents as raw bytes
+	ExportChanged       string
+	ExportRenames       string // old and new path of every rename, json when it ends in .json
+	ImportRenames       string // a map like ExportRenames writes, to make just those renames
+	Takeover            bool   // replace a run lock left in Dir by a run that died
+	SimulateInto        string
+	Precheck            bool
+	SkipUnreadable      bool
+	Dry                 bool
+	Journal             bool
+	ExtCaseSensitive    bool
+	DetectText          bool // search files that look like text by their contents, whatever Exts says
+	Regex               bool
+	Smartcase           bool
+	WholeWord           bool   // only replace finds with no letter, digit or _ either side
+	Not                 string // regex for text whose finds are left alone, e.g. AcmeLegacy when replacing Acme
+	Lnk                 bool
+	Workers             int    // per stage, runtime.NumCPU() when 0
+	Owner               string // user name or uid, on unix only files it owns are touched
+	TempDir             string // for atomic writes' temp files, next to each file when blank
+	TempPrefix          string // .gfrn- when blank
+	TempSuffix          string
+	GitIgnore           bool                 // skip what .gitignore files leave out, as well as .gfrnignore
+	Sidecars            [][]string           // groups of suffixes whose files are renamed together, e.g. .cs, .Designer.cs, .resx
+	Order               string               // what order files are read in: size-desc, size-asc, path, or as found when blank
+	MaxSize             int64                // files bigger than this many bytes are skipped rather than read into memory, no limit when 0
+	StreamLarge         bool                 // replace in files over MaxSize a chunk at a time instead of skipping them
+	Quarantine          bool                 // hold back files with matches in urls, guids, base64 or binary
+	Confirm             func([]Suspect) bool // asked whether to rewrite them anyway, no when nil
+	Ask                 func(Change) Answer  // asked about each rename and rewrite before it's made, when set
+	Progress            func(Progress)       // told how far the run's got as it goes, one call at a time, when set
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Ignore:          []string{".vs", ".git"},
+		CaseCollision:   "warn",
+		OnConflict:      "fail",
+		MaxPerDirAction: "warn",
+		RenameRoot:      true,
+		RenameDirs:      true,
+		RenameFiles:     true,
+		RenameContents:  true,
+		Retries:         2,
+		RetryWait:       time.Second,
+		Lock:            true,
+		Atomic:          true,
+		Charset:         "auto",
+		MaxSize:         10 << 20,
+	}
+}
+
+// begin waits for the Engine's last run to finish, starts a console printing to e.Output,
+// gives each stage opts.Workers workers, starts the run's skips, retries and tally empty and
+// sends progress to opts.Progress. the returned func says the run's done, writes out and
+// stops the console, and lets the next run go
+func (e *Engine) begin(opts Options) func() {
+	e.mu.Lock()
+	e.workers = opts.Workers
+	if e.workers <= 0 {
+		e.workers = runtime.NumCPU()
+	}
+
+	out := e.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	e.console = newConsoleWriter(out, e.workers)
+	e.skips = &skipLog{}
+	e.retries = &retryQueue{skips: e.skips}
+	e.progress = &tracker{}
+	e.progress.start(opts.Progress)
+	e.tally = &counts{}
+
+	return func() {
+		e.progress.finish()
+		e.console.close()
+		e.mu.Unlock()
+	}
+}
+
+// Run makes the run opts describe, returning what it did. the report is filled in as far
+// as the run got when there's an error
+func (e *Engine) Run(ctx context.Context, opts Options) (Report, error) {
+	done := e.begin(opts)
+	defer done()
+
+	start := time.Now()
+	sum := &Report{Dir: opts.Dir, Find: opts.Find, Replace: opts.Replace}
+	err := e.run(ctx, opts, sum)
+	if err != nil {
+		sum.Error = err.Error()
+	}
+	sum.Skipped = e.skips.take()
+	sum.total(e.tally, e.progress.timings())
+	sum.printExts(e.console, opts.Stats)
+	sum.Elapsed = time.Since(start).String()
+	return *sum, err
+}
+
+// setup is what a run works from, made from its options
+type setup struct {
+	reg     *regexp.Regexp // .*(find).*, with the match as its first group
+	replace string
+	eol     string
+	m       matcher
+	wf      *walkFilter
+}
+
+func prepare(ctx context.Context, opts Options) (setup, error) {
+	var s setup
+	if opts.Dir == "" || opts.Find == "" && len(opts.Pairs) == 0 || len(opts.Exts) == 0 && !opts.DetectText && opts.RenameContents {
+		return s, fmt.Errorf("Dir, Find and Exts must be specified and non-blank, or DetectText set instead of Exts")
+	}
+
+	if !opts.RenameDirs && !opts.RenameFiles && !opts.RenameContents {
+		return s, fmt.Errorf("RenameDirs, RenameFiles and RenameContents are all off, there's nothing to do")
+	}
+
+	if opts.CaseCollision != "" && opts.CaseCollision != "warn" && opts.CaseCollision != "fail" {
+		return s, fmt.Errorf("case-collision must be warn or fail")
+	}
+
+	if opts.MaxPerDirAction != "" && opts.MaxPerDirAction != "warn" && opts.MaxPerDirAction != "fail" {
+		return s, fmt.Errorf("max-per-dir-action must be warn or fail")
+	}
+
+	if err := validOnConflict(opts.OnConflict); err != nil {
+		return s, err
+	}
+
+	if opts.Charset != "" {
+		err := validCharset(opts.Charset)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	if opts.MaxSize < 0 {
+		return s, fmt.Errorf("max-size can't be negative")
+	}
+
+	// history is rewritten in one go, there's no trying it out first
+	if opts.History && (opts.Dry || opts.Preview > 0 || opts.SampleRate > 0 || opts.SampleFiles > 0) {
+		return s, fmt.Errorf("-history can't be used with -dry, -preview or -sample, it would rewrite the history anyway")
+	}
+
+	if opts.Order != "" && opts.Order != "size-desc" && opts.Order != "size-asc" && opts.Order != "path" {
+		return s, fmt.Errorf("order must be size-desc, size-asc or path, not %v", opts.Order)
+	}
+
+	var err error
+	s.eol, err = eolOf(opts.EOL)
+	if err != nil {
+		return s, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return s, err
+	}
+
+	s.m, s.reg, err = compileMatcher(opts)
+	if err != nil {
+		return s, err
+	}
+	s.replace = nativeSeparators(opts.Replace)
+
+	ignores := map[string]bool{journalDir: true}
+	for _, name := range opts.Ignore {
+		ignores[strings.ToLower(name)] = true
+	}
+	extMap := map[string]bool{}
+	for _, ext := range opts.Exts {
+		if !opts.ExtCaseSensitive {
+			ext = strings.ToLower(ext)
+		}
+		extMap["."+strings.TrimPrefix(ext, ".")] = true
+	}
+	wf := newWalkFilter(opts.Dir, ignores, extMap, opts.XDev)
+	wf.extCase = opts.ExtCaseSensitive
+	wf.excludeMime = opts.ExcludeMime
+	wf.excludeFiles = pathSet(opts.Dir, opts.ExcludeFiles)
+	wf.charset = opts.Charset
+	wf.detectText = opts.DetectText
+	wf.noContents = !opts.RenameContents
+	wf.ctx = ctx
+	wf.order = opts.Order
+	wf.maxSize = opts.MaxSize
+	wf.streamLarge = opts.StreamLarge
+	wf.lnk = opts.Lnk
+	wf.ignoreFiles = newIgnoreFiles(opts.GitIgnore)
+	s.wf = wf
+
+	if opts.Owner != "" {
+		wf.owner, err = lookupOwner(opts.Owner)
+		if err != nil {
+			return s, fmt.Errorf("Couldn't look up owner %v, %s", opts.Owner, err)
+		}
+	}
+
+	if opts.IfContains != "" {
+		wf.ifContains, err = regexp.Compile(opts.IfContains)
+		if err != nil {
+			return s, fmt.Errorf("Couldn't compile -if-contains %v, %s", opts.IfContains, err)
+		}
+	}
+
+	return s, nil
+}
+
+// compileMatcher makes the matcher for opts' finds, and the regex the searches that
+// only need to know whether a name or file could match go by
+func compileMatcher(opts Options) (matcher, *regexp.Regexp, error) {
+	find := findPattern(opts.Find)
+	if opts.Regex {
+		find = opts.Find
+	}
+	if !opts.CaseSensitive {
+		find = "(?i)" + find
+	}
+
+	findReg, err := regexp.Compile(find)
+	if err != nil {
+		return matcher{}, nil, fmt.Errorf("Couldn't compile %v, %s", opts.Find, err)
+	}
+	reg := regexp.MustCompile(".*(" + find + ").*")
+
+	m := newMatcher(opts.Find, findReg, opts.CaseSensitive)
+	if opts.Regex {
+		m = matcher{reg: findReg, re: true}
+	}
+	if opts.Smartcase || len(opts.Pairs) > 0 {
+		if opts.Regex {
+			return m, nil, fmt.Errorf("-smartcase and -map can't be used with -re")
+		}
+		// smartcase spellings each match exactly, that's the point of them
+		rules := ruleList(opts)
+		pairs, from := findPairs(rules, opts.Smartcase)
+		m, err = newPairsMatcher(pairs, from, len(rules), opts.CaseSensitive || opts.Smartcase)
+		if err != nil {
+			return m, nil, err
+		}
+		reg = m.reg
+	}
+	m.words = opts.WholeWord
+
+	if opts.Not != "" {
+		not := opts.Not
+		if !opts.CaseSensitive {
+			not = "(?i)" + not
+		}
+		m.not, err = regexp.Compile(not)
+		if err != nil {
+			return m, nil, fmt.Errorf("Couldn't compile -not %v, %s", opts.Not, err)
+		}
+	}
+	return m, reg, nil
+}
+
+func (e *Engine) run(ctx context.Context, opts Options, sum *Report) error {
+	if opts.ImportRenames != "" {
+		return e.runRenameMap(ctx, opts, sum)
+	}
+
+	s, err := prepare(ctx, opts)
+	if err != nil {
+		return err
+	}
+	reg, replace, m, wf := s.reg, s.replace, s.m, s.wf
+
+	if opts.Freq {
+		e.frequencies(opts.Dir, m, wf)
+		return nil
+	}
+
+	if opts.List || opts.Count {
+		return e.search(opts.Dir, m, wf, opts, sum)
+	}
+
+	if opts.History {
+		return e.rewriteHistory(opts.Dir, replace, m, wf)
+	}
+
+	if opts.Preview > 0 {
+		e.preview(opts.Dir, replace, opts.Preview, m, wf)
+		return nil
+	}
+
+	if opts.Precheck || opts.SkipUnreadable {
+		err := e.precheck(opts.Dir, reg, wf, opts.SkipUnreadable)
+		if err != nil {
+			return err
+		}
+	}
+
+	renames := addSidecars(e.findRenames(opts.Dir, replace, m, wf, opts), opts.Sidecars, wf)
+	renames, err = e.resolveConflicts(renames, opts.OnConflict)
+	// a dry run lists them in its safety section instead
+	if err != nil && !opts.Dry {
+		return err
+	}
+	sum.Renames = renames
+
+	if opts.SampleRate > 0 || opts.SampleFiles > 0 {
+		e.sample(opts.Dir, replace, opts.SampleRate, opts.SampleFiles, renames, m, opts.FileTimeout, wf)
+		return nil
+	}
+
+	if opts.MaxTotal > 0 || opts.MaxPerDir > 0 {
+		err = e.checkLimits(opts, replace, renames, m, wf)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.OnlyInMatchingFiles {
+		wf.onlyFiles = map[string]bool{}
+		for _, rn := range renames {
+			if !rn.Dir {
+				wf.onlyFiles[rn.Old] = true
+			}
+		}
+	}
+
+	// with more than one rule, which of them fired, as far as the run got
+	sum.Rules = ruleStats(ruleList(opts))
+	if sum.Rules != nil {
+		defer sum.endRules(e.console, m, replace)
+	}
+
+	if opts.Dry {
+		e.dryRun(opts.Dir, replace, renames, m, opts.FileTimeout, wf, sum)
+		return nil
+	}
+
+	if opts.SimulateInto != "" {
+		return e.simulateInto(opts.SimulateInto, opts.Dir, replace, renames, m, opts.FileTimeout, wf, sum)
+	}
+
+	// the last point where stopping leaves everything as it was
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lock, err := e.lockRun(opts.Dir, opts.Takeover)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	var a *asker
+	if opts.Ask != nil {
+		a = &asker{ask: opts.Ask, console: e.console, skips: e.skips}
+		renames = a.renames(renames)
+		sum.Renames = renames
+	}
+
+	temp, err := newTempNames(opts.TempDir, opts.TempPrefix, opts.TempSuffix)
+	if err != nil {
+		return fmt.Errorf("Couldn't use temp dir %v, %s", opts.TempDir, err)
+	}
+	e.scavenge(opts.Dir, temp, wf, lock.tookOver)
+
+	if opts.Snapshot != "" {
+		err = e.writeSnapshot(opts.Snapshot, opts.Dir, renames, reg, m, wf)
+		if err != nil {
+			return fmt.Errorf("Couldn't write snapshot %v, %s", opts.Snapshot, err)
+		}
+	}
+
+	// do directories first. then we won't have to worry about stuff moving
+	// identifiers go first, gopls needs the packages where they are
+	var j *journal
+	if opts.Journal {
+		j, err = newJournal(opts.Dir, renames)
+		if err != nil {
+			return fmt.Errorf("Couldn't start journal in %v, %s", opts.Dir, err)
+		}
+	}
+	if opts.Semantic {
+		err = e.semanticRename(opts.Dir, opts.Find, opts.Replace, wf, j, renames)
+		if err != nil {
+			return err
+		}
+	}
+
+	newpath, j, err := e.makeRenames(ctx, opts, j, renames, sum)
+	lock.moved(newpath)
+	if err != nil {
+		return err
+	}
+	wf.rebase(renames)
+
+	w := writer{lock: opts.Lock, fsync: opts.Fsync, atomic: opts.Atomic, mode: opts.Mode, eol: s.eol, temp: temp}
+	var q *quarantine
+	if opts.Quarantine {
+		q = &quarantine{confirm: opts.Confirm, console: e.console, skips: e.skips}
+	}
+	e.retries.start(opts.Retries, opts.RetryWait)
+	err = e.replaceContents(newpath, replace, m, opts.FileTimeout, wf, w, j, q, a, sum)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return stoppedError(sum, err)
+	}
+
+	if opts.ExportChanged != "" {
+		err = e.exportChanged(opts.ExportChanged, newpath, renames, sum.Files)
+		if err != nil {
+			return fmt.Errorf("Couldn't export changed files to %v, %s", opts.ExportChanged, err)
+		}
+	}
+
+	if opts.ExportRenames != "" {
+		err = writeRenameMap(opts.ExportRenames, opts.Dir, newpath, renames)
+		if err != nil {
+			return fmt.Errorf("Couldn't export renames to %v, %s", opts.ExportRenames, err)
+		}
+	}
+
+	return nil
+}
+
+// findPattern escapes find for use in a regex. path separators match either / or \
+// so a path fragment is found however the file wrote it
+func findPattern(find string) string {
+	var sb strings.Builder
+	start := 0
+	for i, r := range find {
+		if isSeparator(r) {
+			sb.WriteString(regexp.QuoteMeta(find[start:i]))
+			sb.WriteString(`[/\\]`)
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(find[start:]))
+	return sb.String()
+}
+
+// nativeSeparators writes any path separators in a replacement the way this platform does
+func nativeSeparators(replace string) string {
+	return strings.Map(func(r rune) rune {
+		if isSeparator(r) {
+			return filepath.Separator
+		}
+		return r
+	}, replace)
+}
+
+func isSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+type RenameOp struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	Dir bool   `json:"dir,omitempty"`
+}
+
+type ReadOp struct {
+	Path     string
+	Contents []byte // decoded to utf-8 when Charset is set
+	Charset  string
+	Hash     string // sha256 of the file as it is on disk, when asked for
+}
+
+type WriteOp struct {
+	Path     string
+	Contents []byte
+	Charset  string // what Contents are encoded to when written
+	Matches  int
+	Rules    []int // matches for each rule, nil with just the one
+}
+
+// makeRenames carries out renames in opts.Dir, recording them in j, or a journal it starts
+// when opts say to and j is nil, and going through version control when opts say to, and returns where dir ended up. when they
+// stop part way, the journal and sum keep just the ones made, so undo can reverse them
+func (e *Engine) makeRenames(ctx context.Context, opts Options, j *journal, renames []RenameOp, sum *Report) (string, *journal, error) {
+	var err error
+	if opts.Journal && j == nil {
+		j, err = newJournal(opts.Dir, renames)
+		if err != nil {
+			return opts.Dir, nil, fmt.Errorf("Couldn't start journal in %v, %s", opts.Dir, err)
+		}
+	}
+
+	move := os.Rename
+	if opts.VCS {
+		if v := detectVCS(opts.Dir); v != nil {
+			e.console.println("Renaming through", v.name, "in", v.root)
+			move = v.rename
+		}
+	}
+
+	newpath, made, err := e.renameDirs(ctx, opts.Dir, renames, opts.CaseCollision, opts.Fsync, move)
+	if err != nil {
+		sum.Renames = renames[len(renames)-made:]
+		if j != nil {
+			j.Renames = relRenames(opts.Dir, sum.Renames)
+			if err := j.save(); err != nil {
+				e.console.println("Couldn't save journal", j.path, err)
+			}
+		}
+		return newpath, j, err
+	}
+
+	if j != nil {
+		j.moved(newpath)
+	}
+	return newpath, j, nil
+}
+
+// renameDirs makes renames last to first, so everything's renamed before its parent is,
+// and returns where dir ended up and how many were made. once ctx is done no more are
+// started, and those made are the last ones in renames
+func (e *Engine) renameDirs(ctx context.Context, dir string, renames []RenameOp, caseCollision string, fsync bool, move func(string, string) error) (string, int, error) {
+	collisions := caseCollisions(renames)
+	for _, c := range collisions {
+		e.console.println("Names would differ only by case:", strings.Join(c, ", "))
+	}
+	if len(collisions) > 0 && caseCollision == "fail" {
+		return dir, 0, &CaseCollisionError{Names: collisions}
+	}
+
+	unsafe := unsafeNames(renames)
+	for _, rn := range unsafe {
+		e.console.println("Can't rename", rn.Old, "to", filepath.Base(rn.New)+", the name isn't usable on Windows")
+	}
+	if len(unsafe) > 0 {
+		return dir, 0, &ReservedNameError{Renames: unsafe}
+	}
+
+	e.progress.phase(PhaseRename)
+	for i := len(renames) - 1; i >= 0; i-- {
+		made := len(renames) - 1 - i
+		if err := ctx.Err(); err != nil {
+			return dir, made, &StoppedError{Renames: made, Of: len(renames), Err: err}
+		}
+
+		value := renames[i]
+		err := move(value.Old, value.New)
+		if err != nil {
+			return dir, made, &RenameError{Old: value.Old, New: value.New, Err: err}
+		}
+		e.progress.renamed(value.New)
+
+		if fsync {
+			err = syncDir(filepath.Dir(value.New))
+			if err != nil {
+				return dir, made + 1, fmt.Errorf("Couldn't sync %v after renaming %v, %s", filepath.Dir(value.New), value.Old, err)
+			}
+		}
+	}
+
+	newpath := dir
+	if len(renames) > 0 && renames[0].Old == dir {
+		newpath = renames[0].New
+	}
+
+	return newpath, len(renames), nil
+}
+
+// stoppedError says how far a run got before it was told to stop. files being written
+// were finished, and those not yet read left alone
+func stoppedError(sum *Report, err error) error {
+	return &StoppedError{Renames: len(sum.Renames), Files: len(sum.Files), Err: err}
+}
+
+func renameMap(renames []RenameOp) map[string]string {
+	m := make(map[string]string, len(renames))
+	for _, rn := range renames {
+		m[rn.Old] = rn.New
+	}
+	return m
+}
+
+// renamedPath maps a path from before the renames to where it is after them
+func renamedPath(renamed map[string]string, path string) string {
+	if n, ok := renamed[path]; ok {
+		return filepath.Join(renamedPath(renamed, filepath.Dir(path)), filepath.Base(n))
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(renamedPath(renamed, parent), filepath.Base(path))
+}
+
+// findRenames lists the directories to rename, in the order the walk finds them, and then
+// the files. renames are made last to first, so the files are all renamed, then each
+// directory before its parent, and no rename is made to a path an earlier one has moved
+func (e *Engine) findRenames(dir, replace string, m matcher, wf *walkFilter, opts Options) []RenameOp {
+	e.progress.phase(PhaseFind)
+	dirs, files := []RenameOp{}, []RenameOp{}
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			e.console.println(err)
+			return err
+		}
+		if wf.stopped() {
+			return filepath.SkipAll
+		}
+		e.progress.walked()
+
+		if wf.skipDir(path, d) {
+			return filepath.SkipDir
+		}
+
+		if wf.excludedPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if wf.ignoredFile(path, d) || wf.notOwned(d) {
+			return nil
+		}
+
+		if path == dir && !opts.RenameRoot || d.IsDir() && !opts.RenameDirs || !d.IsDir() && !opts.RenameFiles {
+			return nil
+		}
+
+		newthisname, ok := m.rename(d.Name(), replace)
+		if !ok {
+			return nil
+		}
+
+		curdir := filepath.Dir(path)
+		renameTo := filepath.Join(curdir, newthisname)
+		if d.IsDir() {
+			dirs = append(dirs, RenameOp{Old: path, New: renameTo, Dir: true})
+		} else {
+			files = append(files, RenameOp{Old: path, New: renameTo})
+		}
+
+		return nil
+	})
+
+	return append(dirs, files...)
+}
+
+// replaceContents streams the content pass: readers feed updaters, which feed writers, each
+// through a channel a few workers deep, so only about as many files as there are workers
+// are held in memory at once, however big the tree is. files over -max-size to stream go
+// after those, and files q holds back after the rest, if at all
+func (e *Engine) replaceContents(dir, replace string, m matcher, budget time.Duration, wf *walkFilter, w writer, j *journal, q *quarantine, a *asker, sum *Report) error {
+	e.progress.phase(PhaseContents)
+	e.tally.reset()
+	scanned := []ReadOp{} // paths only, for the stats
+	reads := make(chan ReadOp, e.workers)
+	go func() {
+		defer close(reads)
+		for rd := range e.streamRead(e.walkTextFiles(dir, wf), wf, false) {
+			scanned = append(scanned, ReadOp{Path: rd.Path})
+			if q != nil && q.hold(rd, m) {
+				continue
+			}
+			reads <- rd
+		}
+	}()
+
+	writes, err := e.brokerWrite(a.filter(e.streamUpdate(reads, m, replace, budget)), w, j, dir)
+	if err == nil {
+		large := wf.takeLarge()
+		for _, path := range large {
+			scanned = append(scanned, ReadOp{Path: path})
+		}
+
+		var more []WriteOp
+		more, err = e.streamFiles(large, m, replace, wf, w, j, q, a, dir)
+		writes = append(writes, more...)
+	}
+	if err == nil && q != nil && (len(q.held) > 0 || len(q.large) > 0) {
+		sum.Quarantined = q.suspects
+		if q.release() {
+			held := make(chan ReadOp, e.workers)
+			go func() {
+				defer close(held)
+				for _, rd := range q.held {
+					held <- rd
+				}
+			}()
+
+			var more []WriteOp
+			more, err = e.brokerWrite(a.filter(e.streamUpdate(held, m, replace, budget)), w, j, dir)
+			writes = append(writes, more...)
+			if err == nil {
+				more, err = e.streamFiles(q.large, m, replace, wf, w, j, nil, a, dir)
+				writes = append(writes, more...)
+			}
+		}
+	}
+	if err == nil {
+		var read []ReadOp
+		var more []WriteOp
+		read, more, err = e.retryFailed(dir, replace, m, budget, wf, w, j, a)
+		scanned = append(scanned, read...)
+		writes = append(writes, more...)
+	} else {
+		e.retries.stop()
+	}
+	sum.addWrites(writes)
+	sum.Exts = statsByExt(scanned, writes)
+
+	if err != nil {
+		return fmt.Errorf("Couldn't back up files to the journal, nothing after them was rewritten, %s", err)
+	}
+	return nil
+}
+
+// walkTextFiles streams the paths of text files under dir as the walk finds them,
+// so reading can start before the walk is done. a file hardlinked into the tree more
+// than once is only sent the first time, so it isn't replaced in twice. with wf.order the
+// whole walk is done first and the paths sent in that order instead
+func (e *Engine) walkTextFiles(dir string, wf *walkFilter) <-chan string {
+	paths := make(chan string, e.workers*2)
+
+	go func() {
+		defer close(paths)
+		linked := map[fileID]string{}
+		var found []sizedPath
+
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				e.console.println(err)
+				return err
+			}
+			if wf.stopped() {
+				return filepath.SkipAll
+			}
+
+			if wf.skipDir(path, d) || wf.excludedPath(path) && d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			if !wf.textFile(path, d) {
+				return nil
+			}
+
+			var size int64
+			if info, err := d.Info(); err == nil {
+				size = info.Size()
+				if id, links, ok := linksOf(info); ok && links > 1 {
+					if first, ok := linked[id]; ok {
+						e.console.println("Skipping", path, "it's a hardlink to", first)
+						return nil
+					}
+					linked[id] = path
+				}
+			}
+			if big, skip := wf.tooBig(path, size); big {
+				if skip {
+					e.console.println("Skipping", path, "it's", size, "bytes, over -max-size", wf.maxSize)
+					e.skips.add(path, fmt.Sprintf("over max size, %d bytes", size))
+				}
+				return nil
+			}
+
+			e.progress.walked()
+			if wf.order != "" {
+				found = append(found, sizedPath{path, size})
+				return nil
+			}
+			paths <- path
+
+			return nil
+		})
+		e.progress.walkDone()
+
+		sortPaths(found, wf.order)
+		for _, sp := range found {
+			if wf.stopped() {
+				return
+			}
+			paths <- sp.path
+		}
+	}()
+
+	return paths
+}
+
+type sizedPath struct {
+	path string
+	size int64
+}
+
+// sortPaths puts paths in order: size-desc so the biggest files start first rather than
+// trailing on after the rest are done, size-asc, or path
+func sortPaths(list []sizedPath, order string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		switch order {
+		case "size-desc":
+			return list[i].size > list[j].size
+		case "size-asc":
+			return list[i].size < list[j].size
+		default:
+			return list[i].path < list[j].path
+		}
+	})
+}
+
+// streamRead reads paths with a pool of workers, sending each file on as it's read. with
+// hash, the workers also hash what they read, so anything needing hashes gets them without
+// another pass over the files
+func (e *Engine) streamRead(paths <-chan string, wf *walkFilter, hash bool) <-chan ReadOp {
+	readOps := make(chan ReadOp, e.workers)
+	var wg sync.WaitGroup
+	wg.Add(e.workers)
+
+	for i := 0; i < e.workers; i++ {
+		go func() {
+			for path := range paths {
+				if wf.stopped() {
+					continue
+				}
+				if op, ok := e.read(path, wf, hash); ok {
+					readOps <- op
+				}
+			}
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(readOps)
+	}()
+
+	return readOps
+}
+
+// brokerRead is streamRead gathered up, for what needs every file at once
+func (e *Engine) brokerRead(paths <-chan string, wf *walkFilter, hash bool) []ReadOp {
+	a := []ReadOp{}
+	for r := range e.streamRead(paths, wf, hash) {
+		a = append(a, r)
+	}
+
+	return a
+}
+
+func (e *Engine) read(path string, wf *walkFilter, hash bool) (ReadOp, bool) {
+	shortcut := isShortcut(path)
+	if wf.detectText && !shortcut && !wf.looksText(path) {
+		e.progress.scanned(path, 0)
+		return ReadOp{}, false
+	}
+
+	bytes, err := os.ReadFile(path)
+	e.progress.scanned(path, int64(len(bytes)))
+	if err != nil {
+		e.console.println("Got error reading file", path)
+		e.retries.read(path, err)
+		return ReadOp{}, false
+	}
+
+	op := ReadOp{Path: path}
+	if hash {
+		op.Hash = hashBytes(bytes)
+	}
+
+	if shortcut {
+		// binary, rewriteShortcut finds the paths in it
+		op.Contents = bytes
+		return op, true
+	}
+	op.Contents, op.Charset, err = decodeContents(bytes, wf.charset)
+	if err != nil {
+		// it's still searched as it is, it just can't match as text
+		e.console.println("Searching", path, "as bytes,", err)
+	}
+	if wf.excludedContent(op.Contents) {
+		return ReadOp{}, false
+	}
+	return op, true
+}
+
+// streamUpdate replaces in reads with a pool of workers, sending on the files that changed
+func (e *Engine) streamUpdate(reads <-chan ReadOp, m matcher, replace string, budget time.Duration) <-chan WriteOp {
+	writeOps := make(chan WriteOp, e.workers)
+	var wg sync.WaitGroup
+	wg.Add(e.workers)
+
+	for i := 0; i < e.workers; i++ {
+		go func() {
+			for read := range reads {
+				var write WriteOp
+				var ok bool
+				if budget > 0 {
+					write, ok = e.updateWithin(read, m, replace, budget)
+				} else {
+					write, ok = e.updateFile(read, m, replace)
+				}
+
+				if ok {
+					e.tally.matched.Add(1)
+					writeOps <- write
+				}
+			}
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(writeOps)
+	}()
+
+	return writeOps
+}
+
+func (e *Engine) brokerUpdate(list []ReadOp, m matcher, replace string, budget time.Duration) []WriteOp {
+	reads := make(chan ReadOp, e.workers)
+	go func() {
+		for _, rd := range list {
+			reads <- rd
+		}
+		close(reads)
+	}()
+
+	a := []WriteOp{}
+	for wr := range e.streamUpdate(reads, m, replace, budget) {
+		a = append(a, wr)
+		e.progress.changed(wr.Path, wr.Matches)
+	}
+
+	return a
+}
+
+func (e *Engine) updateFile(read ReadOp, m matcher, replace string) (WriteOp, bool) {
+	if isShortcut(read.Path) {
+		replaced, n, err := rewriteShortcut(read.Contents, shortcutPath(replace), m)
+		if err != nil {
+			e.console.println("Couldn't rewrite shortcut", read.Path, err)
+			e.skips.fail(read.Path, err)
+			return WriteOp{}, false
+		}
+		if n == 0 {
+			return WriteOp{}, false
+		}
+		return WriteOp{Path: read.Path, Contents: replaced, Matches: n}, true
+	}
+
+	bom, contents := cutBOM(read.Contents)
+	var replaced []byte
+	var n int
+	var rules []int
+	if h := handlerFor(read.Path, contents); h != nil {
+		var err error
+		replaced, n, rules, err = rewriteWith(h, read.Path, contents, m, replace)
+		if err != nil {
+			e.console.println(err)
+			e.skips.fail(read.Path, err)
+			return WriteOp{}, false
+		}
+	} else {
+		replaced, n, rules = m.replaceCounted(contents, replace)
+	}
+	if n == 0 {
+		return WriteOp{}, false
+	}
+	replaced = keepLineEnding(contents, replaced)
+	if bom != nil {
+		replaced = append(append([]byte{}, bom...), replaced...)
+	}
+	return WriteOp{Path: read.Path, Contents: replaced, Charset: read.Charset, Matches: n, Rules: rules}, true
+}
+
+// updateWithin gives up on a file that takes longer than budget, e.g. a huge single line
+// minified file against a broad pattern, so it can't stall a worker. a regex can't be
+// interrupted, so the abandoned update finishes in the background and is thrown away
+func (e *Engine) updateWithin(read ReadOp, m matcher, replace string, budget time.Duration) (WriteOp, bool) {
+	type result struct {
+		write WriteOp
+		ok    bool
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		write, ok := e.updateFile(read, m, replace)
+		done <- result{write, ok}
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.write, r.ok
+	case <-timer.C:
+		e.console.println("Skipped", read.Path, "took longer than", budget)
+		e.skips.fail(read.Path, &TimeoutError{Path: read.Path, After: budget})
+		return WriteOp{}, false
+	}
+}
+
+// brokerWrite gives the files on each device their own pool of workers, so a slow mount,
+// like a network share, can't hold up writes to a fast disk in the same tree until its queue
+// is full. with a journal, files are backed up a batch at a time before any in the batch is
+// written, and the first backup that fails stops the writing. it returns what was sent to
+// be written, without the contents
+func (e *Engine) brokerWrite(writes <-chan WriteOp, w writer, j *journal, root string) ([]WriteOp, error) {
+	devs := map[string]uint64{} // by directory
+	pools := map[uint64]chan WriteOp{}
+	var wg sync.WaitGroup
+
+	// what's written, for the report. a file whose write fails is left out, it's skipped,
+	// or when it's retried, what the retry writes counts it
+	var mu sync.Mutex
+	done := []WriteOp{}
+
+	pool := func(path string) chan WriteOp {
+		d := filepath.Dir(path)
+		dev, ok := devs[d]
+		if !ok {
+			if info, err := os.Stat(d); err == nil {
+				dev, _ = deviceOf(info)
+			}
+			devs[d] = dev
+		}
+
+		ch, ok := pools[dev]
+		if !ok {
+			ch = make(chan WriteOp, e.workers)
+			pools[dev] = ch
+			wg.Add(e.workers)
+			for i := 0; i < e.workers; i++ {
+				go func() {
+					for wr := range ch {
+						if e.writeFile(wr, w) {
+							mu.Lock()
+							done = append(done, WriteOp{Path: wr.Path, Charset: wr.Charset, Matches: wr.Matches, Rules: wr.Rules})
+							mu.Unlock()
+						}
+					}
+					wg.Done()
+				}()
+			}
+		}
+		return ch
+	}
+
+	size := 1
+	if j != nil {
+		size = e.workers
+	}
+
+	batch := []WriteOp{}
+	send := func() error {
+		if j != nil && len(batch) > 0 {
+			err := j.backup(root, batch)
+			if err != nil {
+				return err
+			}
+		}
+		for _, wr := range batch {
+			pool(wr.Path) <- wr
+			e.progress.changed(wr.Path, wr.Matches)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	var err error
+	for wr := range writes {
+		batch = append(batch, wr)
+		if len(batch) >= size {
+			if err = send(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = send()
+	}
+
+	for range writes {
+		// drained so the readers and updaters can finish
+	}
+	for _, ch := range pools {
+		close(ch)
+	}
+	wg.Wait()
+
+	return done, err
+}
+
+// writer holds how rewritten files are put on disk
+type writer struct {
+	lock   bool
+	fsync  bool
+	atomic bool
+	mode   os.FileMode // 0 keeps each file's own mode
+	eol    string      // line ending every rewritten file is given, "" keeps their own
+	temp   tempNames
+}
+
+// writeFile replaces the file at wr.Path. with lock, it waits for an exclusive advisory
+// lock on the old file before removing it, and holds one on the new file until it is fully
+// written, so cooperating readers that take a shared lock never see a partial file. it's
+// false when the file wasn't written, and has been skipped or queued to retry
+func (e *Engine) writeFile(wr WriteOp, w writer) bool {
+	orig := wr
+	wr.Contents = withLineEnding(wr.Path, wr.Contents, w.eol)
+	contents, err := encodeContents(wr.Contents, wr.Charset)
+	if err != nil {
+		err = &EncodingError{Path: wr.Path, Charset: wr.Charset, Err: err}
+		e.console.println(err)
+		e.skips.fail(wr.Path, err)
+		return false
+	}
+	wr.Contents = contents
+
+	if w.lock {
+		if old, err := os.Open(wr.Path); err == nil {
+			err = lockFile(old)
+			if err != nil {
+				e.console.println("Couldn't lock", wr.Path, err)
+			}
+			defer old.Close()
+		}
+	}
+
+	// replacing the file, atomically or not, would cut it off from its other hardlinks,
+	// so a hardlinked file is truncated and rewritten in place instead. a replaced file
+	// is given the mode the old one had, including setuid, setgid and sticky bits
+	hardlinked := false
+	mode := w.mode
+	if info, err := os.Lstat(wr.Path); err == nil {
+		_, links, ok := linksOf(info)
+		hardlinked = ok && links > 1
+		if mode == 0 {
+			mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		}
+	}
+
+	// alternate data streams on ntfs are part of the file, so a file replaced atomically
+	// is given copies of them, and one that isn't is rewritten in place to keep them
+	streams, _ := altStreams(wr.Path)
+
+	if w.atomic && !hardlinked {
+		err := e.writeAtomic(wr.Path, wr.Contents, mode, streams, w)
+		if err != nil {
+			e.console.println("Got error writing file", wr.Path, err)
+			e.retries.write(orig, err)
+			return false
+		}
+		e.tally.wrote(int64(len(wr.Contents)))
+		return true
+	}
+
+	inPlace := hardlinked || len(streams) > 0
+	if !inPlace {
+		err = os.Remove(wr.Path)
+		if err != nil {
+			e.console.println("Couldn't remove path", wr.Path, err)
+		}
+	}
+
+	f, err := os.OpenFile(wr.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		e.console.println("Got error writing file", wr.Path, err)
+		e.retries.write(orig, err)
+		return false
+	}
+	defer f.Close()
+
+	if mode != 0 {
+		err = f.Chmod(mode)
+		if err != nil {
+			e.console.println("Couldn't chmod", wr.Path, err)
+		}
+	}
+
+	if w.lock && !inPlace { // the old file's lock already covers it
+		err = lockFile(f)
+		if err != nil {
+			e.console.println("Couldn't lock", wr.Path, err)
+		}
+	}
+
+	_, err = f.Write(wr.Contents)
+	if err != nil {
+		e.console.println("Got error writing file", wr.Path, err)
+		e.retries.write(orig, err)
+		return false
+	}
+	e.tally.wrote(int64(len(wr.Contents)))
+
+	if w.fsync {
+		err = f.Sync()
+		if err == nil {
+			err = syncDir(filepath.Dir(wr.Path))
+		}
+		if err != nil {
+			e.console.println("Couldn't sync", wr.Path, err)
+		}
+	}
+	return true
+}
+
+// syncDir flushes a directory's entries to disk, so renames and newly created files in it
+// survive a crash. windows can't open directories for syncing and doesn't need it
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
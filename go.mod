@@ -1,3 +1,9 @@
 module github.com/jasontconnell/gfrn
 
 go 1.20
+
+require (
+	golang.org/x/sys v0.30.0
+	golang.org/x/term v0.29.0
+	golang.org/x/text v0.22.0
+)
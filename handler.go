@@ -0,0 +1,87 @@
+package gfrn
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Handler rewrites files of a format that shouldn't be replaced in as plain text, like an
+// ini file whose section names must stay put, or a .strings file whose keys must. the
+// content pass hands files with an extension a handler is registered for to it instead.
+// contents are utf-8, decoded from the file's charset as they are for plain text
+type Handler interface {
+	// Match is true when the handler takes the file at path, which has content, e.g. an
+	// xml plist but not a binary one
+	Match(path string, content []byte) bool
+
+	// Rewrite returns content with replace called on the parts the run should change.
+	// replace does the run's finds and replaces on what it's given, and counts the
+	// matches; it's only to be called from the goroutine Rewrite was called on
+	Rewrite(content []byte, replace func([]byte) []byte) ([]byte, error)
+}
+
+// handlers are the registered handlers by extension, each extension's in the order they
+// were registered
+var handlers = struct {
+	sync.RWMutex
+	byExt map[string][]Handler
+}{byExt: map[string][]Handler{}}
+
+// RegisterHandler has h rewrite files ending in ext, like .ini or .d.ts, whatever their
+// case. it's meant to be called from an init func, like registering an image format.
+// an extension can have more than one handler, and the first whose Match is true gets
+// the file
+func RegisterHandler(ext string, h Handler) {
+	ext = "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+	handlers.Lock()
+	defer handlers.Unlock()
+	handlers.byExt[ext] = append(handlers.byExt[ext], h)
+}
+
+// handlerFor is the handler that takes the file at path, nil for plain text. as with
+// exts, every dotted suffix of the name is tried, longest first
+func handlerFor(path string, content []byte) Handler {
+	handlers.RLock()
+	defer handlers.RUnlock()
+	if len(handlers.byExt) == 0 {
+		return nil
+	}
+
+	name := strings.ToLower(path[strings.LastIndexAny(path, `/\`)+1:])
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] != '.' {
+			continue
+		}
+		for _, h := range handlers.byExt[name[i:]] {
+			if h.Match(path, content) {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteWith has h rewrite content, counting the matches replace makes as plain text
+// replacement would
+func rewriteWith(h Handler, path string, content []byte, m matcher, replace string) ([]byte, int, []int, error) {
+	n := 0
+	var rules []int
+	out, err := h.Rewrite(content, func(b []byte) []byte {
+		replaced, k, counts := m.replaceCounted(b, replace)
+		n += k
+		if counts != nil {
+			if rules == nil {
+				rules = make([]int, len(counts))
+			}
+			for i, c := range counts {
+				rules[i] += c
+			}
+		}
+		return replaced
+	})
+	if err != nil {
+		return content, 0, nil, fmt.Errorf("Couldn't rewrite %v with its handler, %w", path, err)
+	}
+	return out, n, rules, nil
+}
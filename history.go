@@ -0,0 +1,415 @@
+package gfrn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rewriteHistory applies the renames and content replacements to every commit in the git
+// repository at dir, not just the checked out tree. it streams git fast-export through
+// historyRewriter into git fast-import, then checks the rewritten HEAD out. commit hashes
+// all change, so this is for when the old name has to be gone from history
+func (e *Engine) rewriteHistory(dir, replace string, m matcher, wf *walkFilter) error {
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--untracked-files=no").Output()
+	if err != nil {
+		return fmt.Errorf("%v isn't a git repository, %s", dir, err)
+	}
+	if len(bytes.TrimSpace(status)) > 0 {
+		return fmt.Errorf("%v has uncommitted changes, commit or stash them before rewriting history", dir)
+	}
+
+	export := exec.Command("git", "fast-export", "--all", "--signed-tags=strip", "--tag-of-filtered-object=rewrite", "--reencode=yes")
+	export.Dir = dir
+	export.Stderr = os.Stderr
+	in, err := export.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	imp := exec.Command("git", "fast-import", "--force", "--quiet")
+	imp.Dir = dir
+	imp.Stdout = e.console
+	imp.Stderr = os.Stderr
+	out, err := imp.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	err = export.Start()
+	if err != nil {
+		return err
+	}
+	err = imp.Start()
+	if err != nil {
+		export.Process.Kill()
+		return err
+	}
+
+	hr := &historyRewriter{e: e, dir: dir, replace: replace, m: m, wf: wf}
+	bw := bufio.NewWriter(out)
+	ferr := hr.filter(bufio.NewReader(in), bw)
+	if ferr == nil {
+		ferr = bw.Flush()
+	}
+	out.Close()
+
+	if ferr != nil {
+		export.Process.Kill()
+	}
+	eerr := export.Wait()
+	ierr := imp.Wait()
+
+	switch {
+	case ferr != nil:
+		return fmt.Errorf("Couldn't rewrite history, %s", ferr)
+	case eerr != nil:
+		return fmt.Errorf("git fast-export failed, %s", eerr)
+	case ierr != nil:
+		return fmt.Errorf("git fast-import failed, %s", ierr)
+	}
+
+	reset := exec.Command("git", "-C", dir, "reset", "--hard", "--quiet")
+	reset.Stdout, reset.Stderr = e.console, os.Stderr
+	err = reset.Run()
+	if err != nil {
+		return fmt.Errorf("history was rewritten but the new HEAD couldn't be checked out, %s", err)
+	}
+
+	e.console.println("Rewrote", hr.blobs, "blobs and", hr.paths, "paths across", hr.commits, "commits")
+	return nil
+}
+
+type historyBlob struct {
+	header []string // blob, mark and anything else before the data
+	data   []byte
+	mark   string
+}
+
+// historyRewriter filters a fast-export stream. fast-export writes the new blobs of a
+// commit just before the commit, so blobs are held until the commit's file lines say
+// which path each is first used at, and so whether it's a text file by extension
+type historyRewriter struct {
+	e            *Engine
+	dir, replace string
+	m            matcher
+	wf           *walkFilter
+
+	pending               []historyBlob
+	blobs, paths, commits int
+}
+
+func (hr *historyRewriter) filter(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return hr.flushBlobs(w, nil)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		switch {
+		case line == "\n" && len(hr.pending) > 0:
+			// the optional newline after a held blob's data, flushBlobs writes its own
+		case line == "blob\n":
+			err = hr.readBlob(r, line)
+		case strings.HasPrefix(line, "commit "):
+			err = hr.commit(r, w, line)
+		case line == "done\n":
+			err = hr.flushBlobs(w, nil)
+			if err == nil {
+				_, err = w.WriteString(line)
+			}
+		default:
+			// resets, tags and the like never use blobs, held ones can wait for their commit
+			err = copyCommand(r, w, line)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (hr *historyRewriter) readBlob(r *bufio.Reader, first string) error {
+	blob := historyBlob{header: []string{first}}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(line, "data ") {
+			blob.data, err = readData(r, line)
+			if err != nil {
+				return err
+			}
+			hr.pending = append(hr.pending, blob)
+			return nil
+		}
+
+		if strings.HasPrefix(line, "mark ") {
+			blob.mark = strings.TrimSpace(strings.TrimPrefix(line, "mark "))
+		}
+		blob.header = append(blob.header, line)
+	}
+}
+
+// commit reads a commit through to the blank line that ends it, rewriting the paths of its
+// file lines and the contents of the blobs, pending or inline, that they use
+func (hr *historyRewriter) commit(r *bufio.Reader, w *bufio.Writer, first string) error {
+	hr.commits++
+	var buf bytes.Buffer
+	buf.WriteString(first)
+	blobPaths := map[string]string{}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "data "):
+			data, err := readData(r, line)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "data %d\n", len(data))
+			buf.Write(data)
+		case strings.HasPrefix(line, "M "):
+			fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 4)
+			if len(fields) != 4 {
+				return fmt.Errorf("bad file line %q", line)
+			}
+			path, err := unquotePath(fields[3])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(&buf, "M %s %s %s\n", fields[1], fields[2], quotePath(hr.renamePath(path), false))
+			if fields[2] == "inline" {
+				dline, err := r.ReadString('\n')
+				if err != nil {
+					return err
+				}
+				data, err := readData(r, dline)
+				if err != nil {
+					return err
+				}
+				data = hr.rewriteBlob(path, data)
+				fmt.Fprintf(&buf, "data %d\n", len(data))
+				buf.Write(data)
+			} else if _, ok := blobPaths[fields[2]]; !ok {
+				blobPaths[fields[2]] = path
+			}
+		case strings.HasPrefix(line, "D "):
+			path, err := unquotePath(strings.TrimSuffix(line[2:], "\n"))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "D %s\n", quotePath(hr.renamePath(path), false))
+		case strings.HasPrefix(line, "C "), strings.HasPrefix(line, "R "):
+			src, dst, err := splitPathPair(strings.TrimSuffix(line[2:], "\n"))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "%c %s %s\n", line[0], quotePath(hr.renamePath(src), true), quotePath(hr.renamePath(dst), false))
+		default:
+			buf.WriteString(line)
+		}
+
+		if line == "\n" {
+			break
+		}
+	}
+
+	err := hr.flushBlobs(w, blobPaths)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (hr *historyRewriter) flushBlobs(w *bufio.Writer, blobPaths map[string]string) error {
+	for _, blob := range hr.pending {
+		data := blob.data
+		if path, ok := blobPaths[blob.mark]; ok {
+			data = hr.rewriteBlob(path, data)
+		}
+
+		for _, h := range blob.header {
+			w.WriteString(h)
+		}
+		fmt.Fprintf(w, "data %d\n", len(data))
+		w.Write(data)
+		_, err := w.WriteString("\n")
+		if err != nil {
+			return err
+		}
+	}
+	hr.pending = hr.pending[:0]
+	return nil
+}
+
+func (hr *historyRewriter) rewriteBlob(path string, data []byte) []byte {
+	name := filepath.Base(filepath.FromSlash(path))
+	if hr.ignoredPath(path) || !hr.wf.textName(name) {
+		return data
+	}
+
+	contents, charset, _ := decodeContents(data, hr.wf.charset)
+	if hr.wf.excludedContent(contents) {
+		return data
+	}
+	write, ok := hr.e.updateFile(ReadOp{Path: path, Contents: contents, Charset: charset}, hr.m, hr.replace)
+	if !ok {
+		return data
+	}
+
+	encoded, err := encodeContents(write.Contents, write.Charset)
+	if err != nil {
+		return data
+	}
+	hr.blobs++
+	return encoded
+}
+
+// renamePath renames each component of a repository path the way findRenames would
+// rename the file or directory it names
+func (hr *historyRewriter) renamePath(path string) string {
+	if hr.ignoredPath(path) {
+		return path
+	}
+
+	parts := strings.Split(path, "/")
+	changed := false
+	for i, part := range parts {
+		renamed, ok := hr.m.rename(part, hr.replace)
+		if !ok {
+			continue
+		}
+		parts[i] = renamed
+		changed = true
+	}
+
+	if !changed {
+		return path
+	}
+	hr.paths++
+	return strings.Join(parts, "/")
+}
+
+func (hr *historyRewriter) ignoredPath(path string) bool {
+	if hr.wf.excludedPath(filepath.Join(hr.dir, filepath.FromSlash(path))) {
+		return true
+	}
+
+	for _, name := range strings.Split(path, "/") {
+		if hr.wf.ignoredName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyCommand passes a line through, along with the data that follows it if it's a data command
+func copyCommand(r *bufio.Reader, w *bufio.Writer, line string) error {
+	if !strings.HasPrefix(line, "data ") {
+		_, err := w.WriteString(line)
+		return err
+	}
+
+	data, err := readData(r, line)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "data %d\n", len(data))
+	_, err = w.Write(data)
+	return err
+}
+
+func readData(r *bufio.Reader, line string) ([]byte, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "data ")))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported data command %q", line)
+	}
+
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// unquotePath reads a path as fast-export writes it, c style quoted when it has to be
+func unquotePath(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	return strconv.Unquote(s)
+}
+
+// splitPathPair splits the source and destination of a copy or rename line. the source
+// is quoted if it contains a space
+func splitPathPair(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("bad quoted path %q", s)
+		}
+
+		src, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", err
+		}
+		dst, err := unquotePath(strings.TrimPrefix(s[end+1:], " "))
+		return src, dst, err
+	}
+
+	i := strings.Index(s, " ")
+	if i == -1 {
+		return "", "", fmt.Errorf("bad path pair %q", s)
+	}
+	dst, err := unquotePath(s[i+1:])
+	return s[:i], dst, err
+}
+
+// quotePath quotes a path for fast-import when it has to be, which for the source of a
+// copy or rename includes containing a space
+func quotePath(path string, source bool) string {
+	if !strings.HasPrefix(path, `"`) && !strings.ContainsAny(path, "\n\\") && !(source && strings.Contains(path, " ")) {
+		return path
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,175 @@
+package gfrn
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// gfrnIgnore is gfrn's own .gitignore, read in every directory of a run
+const gfrnIgnore = ".gfrnignore"
+
+// ignoreFiles reads the ignore files, .gfrnignore and with -gitignore .gitignore, of each
+// directory a walk looks into, the first time it's asked about something in one
+type ignoreFiles struct {
+	names []string
+
+	mu    sync.Mutex
+	rules map[string][]ignoreRule // by directory
+}
+
+type ignoreRule struct {
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path from the ignore file's directory, not just the name
+}
+
+func newIgnoreFiles(gitignore bool) *ignoreFiles {
+	ig := &ignoreFiles{names: []string{gfrnIgnore}, rules: map[string][]ignoreRule{}}
+	if gitignore {
+		ig.names = append([]string{".gitignore"}, ig.names...)
+	}
+	return ig
+}
+
+// ignored is true when the rules in the ignore files from root down to path's directory
+// leave path out. like git, the last rule to match wins, so a ! rule or a deeper file's
+// rules can bring back what an earlier rule left out
+func (ig *ignoreFiles) ignored(root, path string, isDir bool) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	ignored := false
+	dir := root
+	for i := range parts {
+		sub := strings.Join(parts[i:], "/")
+		for _, r := range ig.rulesIn(dir) {
+			if r.match(sub, parts[len(parts)-1], isDir) {
+				ignored = !r.negate
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return ignored
+}
+
+func (ig *ignoreFiles) rulesIn(dir string) []ignoreRule {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	rules, ok := ig.rules[dir]
+	if !ok {
+		for _, name := range ig.names {
+			if b, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+				rules = append(rules, parseIgnore(b)...)
+			}
+		}
+		ig.rules[dir] = rules
+	}
+	return rules
+}
+
+func (r ignoreRule) match(rel, name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return r.re.MatchString(rel)
+	}
+	return r.re.MatchString(name)
+}
+
+// parseIgnore reads .gitignore syntax: # comments, ! to negate, a trailing / for
+// directories only, a / anywhere else to anchor the pattern to the file's directory,
+// and *, ?, [...] and ** globs
+func parseIgnore(b []byte) []ignoreRule {
+	rules := []ignoreRule{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("^" + globPattern(line) + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// globPattern turns a gitignore glob into a regex, where * and ? stop at slashes and **
+// crosses them
+func globPattern(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package gfrn
+
+import (
+	"bytes"
+	"os"
+)
+
+// Answer is what Options.Ask says to a change
+type Answer int
+
+const (
+	Yes Answer = iota
+	No
+	All  // yes to this change and every one after it
+	Quit // no to this change and every one after it
+)
+
+// Change is a rename, or a rewrite of the file at Path with the first lines that change in
+// Diff, put to Options.Ask before it's made
+type Change struct {
+	Rename *RenameOp
+	Path   string
+	Diff   string
+}
+
+// diffLines is how many changed lines a Change shows
+const diffLines = 5
+
+// asker puts changes to ask one at a time, until it's told all or quit. what it's told no
+// to is reported as skipped
+type asker struct {
+	ask       func(Change) Answer
+	all, quit bool
+	console   *consoleWriter
+	skips     *skipLog
+}
+
+func (a *asker) yes(c Change) bool {
+	a.console.flush()
+	switch a.ask(c) {
+	case Yes:
+		return true
+	case All:
+		a.all = true
+		return true
+	case Quit:
+		a.quit = true
+	}
+	return false
+}
+
+// renames returns the renames the asker says yes to
+func (a *asker) renames(renames []RenameOp) []RenameOp {
+	list := []RenameOp{}
+	for i := range renames {
+		if !a.quit && (a.all || a.yes(Change{Rename: &renames[i]})) {
+			list = append(list, renames[i])
+		} else {
+			a.skips.add(renames[i].Old, "declined")
+		}
+	}
+	return list
+}
+
+// filter passes on the rewrites the asker says yes to, or all of them when there's no
+// asker. it asks from one goroutine, so there's only one question up at a time, and once
+// told to quit drops the rest
+func (a *asker) filter(writes <-chan WriteOp) <-chan WriteOp {
+	if a == nil {
+		return writes
+	}
+
+	out := make(chan WriteOp)
+	go func() {
+		defer close(out)
+		for wr := range writes {
+			if !a.quit && (a.all || a.yes(Change{Path: wr.Path, Diff: changeDiff(wr)})) {
+				out <- wr
+			} else {
+				a.skips.add(wr.Path, "declined")
+			}
+		}
+	}()
+	return out
+}
+
+// changeDiff is the first lines wr changes, against the file as it is on disk
+func changeDiff(wr WriteOp) string {
+	b, err := os.ReadFile(wr.Path)
+	if err != nil {
+		return ""
+	}
+	before, _, _ := decodeContents(b, wr.Charset)
+
+	var buf bytes.Buffer
+	writeChangedLines(&buf, before, wr.Contents, 1, diffLines)
+	return buf.String()
+}
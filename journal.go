@@ -0,0 +1,130 @@
+package gfrn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// journalDir is where runs with -journal record what they change, inside the tree itself
+// so it moves with it. every walk skips it
+const journalDir = ".gfrn"
+
+// journal is one run's entry under journalDir. renames are relative to the tree as it
+// was before the run, the way a Plan records them, and files are relative to the tree as
+// it is after, each with a copy of what it held before
+type journal struct {
+	Dir     string        `json:"dir"`
+	Renames []RenameOp    `json:"renames"`
+	Files   []journalFile `json:"files"`
+
+	path string // the entry's directory
+}
+
+type journalFile struct {
+	Path   string `json:"path"`
+	Backup string `json:"backup"` // relative to the entry's directory
+}
+
+// newJournal starts an entry for a run in dir, recording its renames before any are made
+func newJournal(dir string, renames []RenameOp) (*journal, error) {
+	j := &journal{
+		Dir:     dir,
+		Renames: relRenames(dir, renames),
+		Files:   []journalFile{},
+		path:    filepath.Join(dir, journalDir, time.Now().Format("20060102-150405.000000000")),
+	}
+
+	err := os.MkdirAll(filepath.Join(j.path, "files"), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return j, j.save()
+}
+
+// moved points the journal at its entry once dir has been renamed to root
+func (j *journal) moved(root string) {
+	j.path = filepath.Join(root, journalDir, filepath.Base(j.path))
+}
+
+// backup copies every file about to be rewritten into the entry before any of them are
+func (j *journal) backup(root string, writes []WriteOp) error {
+	for _, wr := range writes {
+		err := j.keep(wr.Path, relSlash(root, wr.Path))
+		if err != nil {
+			return err
+		}
+	}
+	return j.save()
+}
+
+// keep copies the file at path into the entry, to be put back at rel, relative to where
+// the tree is after the run
+func (j *journal) keep(path, rel string) error {
+	name := "files/" + strconv.Itoa(len(j.Files))
+	err := copyFile(path, filepath.Join(j.path, filepath.FromSlash(name)), 0600)
+	if err != nil {
+		return err
+	}
+	j.Files = append(j.Files, journalFile{Path: rel, Backup: name})
+	return nil
+}
+
+func (j *journal) save() error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(j.path, "journal.json"), b, 0600)
+}
+
+// lastJournal loads the most recent entry in the tree at root
+func lastJournal(root string) (*journal, error) {
+	entries, err := os.ReadDir(filepath.Join(root, journalDir))
+	if err != nil {
+		return nil, err
+	}
+
+	last := ""
+	for _, e := range entries {
+		if e.IsDir() {
+			last = e.Name()
+		}
+	}
+	if last == "" {
+		return nil, fmt.Errorf("no runs are recorded in %v", filepath.Join(root, journalDir))
+	}
+
+	j := &journal{path: filepath.Join(root, journalDir, last)}
+	b, err := os.ReadFile(filepath.Join(j.path, "journal.json"))
+	if err != nil {
+		return nil, err
+	}
+	return j, json.Unmarshal(b, j)
+}
+
+// copyFile copies from to a new file to, without holding it all in memory, since it may
+// be a streamed file
+func copyFile(from, to string, perm os.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,65 @@
+package gfrn
+
+import (
+	"path/filepath"
+)
+
+// checkLimits goes through the content pass without writing anything, and stops the run
+// when it would make more than opts.MaxTotal renames and replacements. directories where
+// it would change more than opts.MaxPerDir files, which is usually vendored or generated
+// code the ignores missed, are listed, and stop the run too when MaxPerDirAction is fail
+func (e *Engine) checkLimits(opts Options, replace string, renames []RenameOp, m matcher, wf *walkFilter) error {
+	total := len(renames)
+	changed := map[string]bool{}
+	for _, rn := range renames {
+		if !rn.Dir {
+			changed[rn.Old] = true
+		}
+	}
+	e.progress.phase(PhaseCheck)
+	for wr := range e.streamUpdate(e.streamRead(e.walkTextFiles(opts.Dir, wf), wf, false), m, replace, opts.FileTimeout) {
+		total += wr.Matches
+		changed[wr.Path] = true
+	}
+	// files over -max-size that -stream-large will rewrite are searched a chunk at a time
+	for _, path := range wf.largeFiles() {
+		scan, err := scanStream(path, m, replace, wf, false, false)
+		if err != nil {
+			e.console.println("Couldn't stream", path, err)
+			continue
+		}
+		if scan.matches > 0 {
+			total += scan.matches
+			changed[path] = true
+		}
+	}
+
+	if opts.MaxTotal > 0 && total > opts.MaxTotal {
+		return &LimitError{Limit: "max-total", Max: opts.MaxTotal, Found: total}
+	}
+
+	if opts.MaxPerDir <= 0 {
+		return nil
+	}
+
+	perDir := map[string]int{}
+	for p := range changed {
+		perDir[filepath.Dir(p)]++
+	}
+
+	over := []string{}
+	for dir, n := range perDir {
+		if n > opts.MaxPerDir {
+			over = append(over, dir)
+		}
+	}
+	sortByPath(over, func(i int) string { return over[i] })
+
+	for _, dir := range over {
+		e.console.println(perDir[dir], "files would change in", dir+", more than -max-per-dir", opts.MaxPerDir)
+	}
+	if len(over) > 0 && opts.MaxPerDirAction == "fail" {
+		return &LimitError{Limit: "max-per-dir", Max: opts.MaxPerDir, Over: over}
+	}
+	return nil
+}
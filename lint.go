@@ -0,0 +1,100 @@
+package gfrn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleProblem is something in a set of rules that would have a run with them do what
+// whoever wrote them may not expect
+type RuleProblem struct {
+	Rule    int    `json:"rule"`  // index in the rules, from 0
+	Other   int    `json:"other"` // the other rule it's about, -1 for none
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// the kinds of problem LintRules finds
+const (
+	ProblemDuplicate    = "duplicate"    // two rules find the same text
+	ProblemReintroduces = "reintroduces" // a rule's replacement has its own find in it
+	ProblemChains       = "chains"       // a rule's replacement has another rule's find in it
+	ProblemOverlaps     = "overlaps"     // one rule's find is in, or runs into, another's
+)
+
+// LintRules checks rules, as -map and -mapfile give them, without running them: for rules
+// that find the same text, replacements a second run would replace again, and finds that
+// overlap, where the longer or the first to start wins and the other doesn't fire
+func LintRules(rules [][2]string, caseSensitive bool) ([]RuleProblem, error) {
+	ms := make([]matcher, len(rules))
+	for i, rule := range rules {
+		m, _, err := compileMatcher(Options{Find: rule[0], CaseSensitive: caseSensitive})
+		if err != nil {
+			return nil, err
+		}
+		ms[i] = m
+	}
+	found := func(i int, s string) bool {
+		return len(ms[i].findAll([]byte(s))) > 0
+	}
+	same := func(a, b string) bool {
+		if caseSensitive {
+			return a == b
+		}
+		return strings.EqualFold(a, b)
+	}
+
+	list := []RuleProblem{}
+	add := func(i, j int, kind, format string, a ...interface{}) {
+		list = append(list, RuleProblem{Rule: i, Other: j, Kind: kind, Message: fmt.Sprintf(format, a...)})
+	}
+
+	for i, rule := range rules {
+		if found(i, rule[1]) {
+			add(i, -1, ProblemReintroduces, "%v is in its replacement, so running it again changes it again", rule[0])
+		}
+
+		for j, other := range rules {
+			if j == i {
+				continue
+			}
+			if same(rule[0], other[0]) {
+				if j > i {
+					if rule[1] == other[1] {
+						add(i, j, ProblemDuplicate, "finds the same text as rule %d, with the same replacement", j+1)
+					} else {
+						add(i, j, ProblemDuplicate, "finds the same text as rule %d, which replaces it with %v instead", j+1, other[1])
+					}
+				}
+				continue
+			}
+
+			if found(j, rule[1]) {
+				add(i, j, ProblemChains, "its replacement has rule %d's find %v in it: one run leaves it, a second would replace it", j+1, other[0])
+			}
+
+			if found(i, other[0]) {
+				add(i, j, ProblemOverlaps, "%v is inside rule %d's find %v, which wins where it matches", rule[0], j+1, other[0])
+			} else if k := runsInto(rule[0], other[0], same); k > 0 {
+				add(i, j, ProblemOverlaps, "%v runs into rule %d's find %v, in text like %v only the one starting first is replaced", rule[0], j+1, other[0], rule[0]+other[0][k:])
+			}
+		}
+	}
+	return list, nil
+}
+
+// runsInto is the length of the longest end of a that's also the start of b, shorter than
+// both, or 0. a letter or so in common is left out, names run into each other like that
+// all the time without it mattering
+func runsInto(a, b string, same func(a, b string) bool) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for k := n - 1; k > 0 && k*2 >= n; k-- {
+		if same(a[len(a)-k:], b[:k]) {
+			return k
+		}
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package gfrn
+
+import "testing"
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules [][2]string
+		c     bool
+		kinds []string
+	}{
+		{"clean", [][2]string{{"Alpha", "One"}, {"Beta", "Two"}}, false, nil},
+		{"reintroduces", [][2]string{{"Foo", "FooBar"}}, false, []string{ProblemReintroduces}},
+		{"chains", [][2]string{{"Foo", "Bar"}, {"Bar", "Baz"}}, false, []string{ProblemChains}},
+		{"inside", [][2]string{{"Foo", "X"}, {"FooBar", "Y"}}, false, []string{ProblemOverlaps}},
+		{"runs into", [][2]string{{"abcd", "X"}, {"cdef", "Y"}}, false, []string{ProblemOverlaps}},
+		{"duplicate", [][2]string{{"Foo", "X"}, {"foo", "Y"}}, false, []string{ProblemDuplicate}},
+		{"case sensitive", [][2]string{{"Foo", "X"}, {"foo", "Y"}}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := LintRules(tt.rules, tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.kinds) {
+				t.Fatalf("got %v, want %v", problems, tt.kinds)
+			}
+			for i, p := range problems {
+				if p.Kind != tt.kinds[i] {
+					t.Errorf("got %v, want %v", p, tt.kinds[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package gfrn
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Found is a path that f matches, in its name, its contents or both, and how many times
+type Found struct {
+	Path     string `json:"path"`
+	Dir      bool   `json:"dir,omitempty"`
+	Names    int    `json:"names"`    // matches in its name, when the run would rename it
+	Contents int    `json:"contents"` // matches in its contents
+}
+
+// search only searches, changing nothing. for -list, it lists the paths a run would rename
+// as it finds them, and then every match in text file contents as path:line:column: and
+// the line. for -count, it ends with how many matches there are in each path and in all
+func (e *Engine) search(dir string, m matcher, wf *walkFilter, opts Options, sum *Report) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("Couldn't search %v, %s", dir, err)
+	}
+
+	e.progress.phase(PhaseFind)
+	found := map[string]*Found{}
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			e.console.println(err)
+			return err
+		}
+		if wf.stopped() {
+			return filepath.SkipAll
+		}
+		e.progress.walked()
+
+		if wf.skipDir(path, d) || wf.excludedPath(path) && d.IsDir() {
+			return filepath.SkipDir
+		}
+
+		if wf.excludedPath(path) || wf.ignoredFile(path, d) || wf.notOwned(d) {
+			return nil
+		}
+
+		if path == dir && !opts.RenameRoot || d.IsDir() && !opts.RenameDirs || !d.IsDir() && !opts.RenameFiles {
+			return nil
+		}
+
+		if n := len(m.findAll([]byte(d.Name()))); n > 0 {
+			found[path] = &Found{Path: path, Dir: d.IsDir(), Names: n}
+			if !opts.List {
+				return nil
+			}
+			if d.IsDir() {
+				e.console.println(path + string(filepath.Separator))
+			} else {
+				e.console.println(path)
+			}
+		}
+		return nil
+	})
+
+	e.progress.phase(PhaseContents)
+	e.tally.reset()
+	add := func(path string, n int) {
+		f, ok := found[path]
+		if !ok {
+			f = &Found{Path: path}
+			found[path] = f
+		}
+		f.Contents += n
+	}
+
+	scanned := []ReadOp{}
+	for rd := range e.streamRead(e.walkTextFiles(dir, wf), wf, false) {
+		scanned = append(scanned, ReadOp{Path: rd.Path})
+		if wf.excludedContent(rd.Contents) {
+			continue
+		}
+		if !opts.List {
+			add(rd.Path, len(m.findAll(rd.Contents)))
+			continue
+		}
+		var buf strings.Builder
+		add(rd.Path, listLines(&buf, rd.Path, rd.Contents, 1, m))
+		e.console.printf("%s", buf.String())
+	}
+
+	// files over -max-size are searched a chunk at a time
+	for _, path := range wf.takeLarge() {
+		if wf.stopped() {
+			break
+		}
+		scanned = append(scanned, ReadOp{Path: path})
+		n, err := e.listStream(path, m, wf, opts.List)
+		if err != nil {
+			e.console.println("Couldn't search", path, err)
+			e.skips.fail(path, err)
+			continue
+		}
+		add(path, n)
+	}
+
+	for _, f := range found {
+		if f.Contents > 0 {
+			e.tally.matched.Add(1)
+			sum.Matches += f.Contents
+		}
+		if f.Names > 0 || f.Contents > 0 {
+			sum.Found = append(sum.Found, *f)
+		}
+	}
+	sortByPath(sum.Found, func(i int) string { return sum.Found[i].Path })
+	sum.Exts = statsByExt(scanned, nil)
+
+	if opts.Count {
+		e.printCounts(sum.Found)
+	}
+	return nil
+}
+
+// printCounts is -count's table of the matches in each path's name and contents, in the
+// order of the tree, with the totals under it
+func (e *Engine) printCounts(list []Found) {
+	names, contents, files := 0, 0, 0
+	tw := tabwriter.NewWriter(e.console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "names\tcontents\tpath")
+	for _, f := range list {
+		path := f.Path
+		if f.Dir {
+			path += string(filepath.Separator)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\n", f.Names, f.Contents, path)
+		if f.Names > 0 {
+			names++
+		}
+		if f.Contents > 0 {
+			files++
+		}
+		contents += f.Contents
+	}
+	tw.Flush()
+	e.console.printf("%d names would be renamed, %d matches in the contents of %d files\n", names, contents, files)
+}
+
+// listLines prints each match in b to w as path:line:column: and its line, first being the
+// line b starts on, and returns how many there were
+func listLines(w io.Writer, path string, b []byte, first int, m matcher) int {
+	locs := m.findAll(b)
+	line, start := first, 0
+	for _, loc := range locs {
+		line += bytes.Count(b[start:loc[0]], []byte("\n"))
+		start = bytes.LastIndexByte(b[:loc[0]], '\n') + 1
+
+		end := bytes.IndexByte(b[loc[0]:], '\n')
+		if end == -1 {
+			end = len(b)
+		} else {
+			end += loc[0]
+		}
+		text := strings.TrimSuffix(string(b[start:end]), "\r")
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", path, line, loc[0]-start+1, text)
+	}
+	return len(locs)
+}
+
+// listStream is listLines for a file over -max-size, read a chunk at a time. without print
+// it only counts the matches
+func (e *Engine) listStream(path string, m matcher, wf *walkFilter, print bool) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	c := newChunker(f, m)
+	if wf.detectText && !wf.looksText(path) || wf.excludedType(c.head()) {
+		return 0, nil
+	}
+
+	total := 0
+	for {
+		b, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+		if !print {
+			total += len(m.findAll(b))
+			continue
+		}
+		var buf strings.Builder
+		total += listLines(&buf, path, b, c.line, m)
+		e.console.printf("%s", buf.String())
+	}
+	return total, nil
+}
@@ -0,0 +1,414 @@
+package gfrn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// shell link (.lnk) layout, from [MS-SHLLINK]
+const (
+	lnkHeaderSize = 0x4c
+
+	lnkHasIDList       = 0x1
+	lnkHasLinkInfo     = 0x2
+	lnkHasName         = 0x4
+	lnkHasRelativePath = 0x8
+	lnkHasWorkingDir   = 0x10
+	lnkHasArguments    = 0x20
+	lnkHasIconLocation = 0x40
+	lnkIsUnicode       = 0x80
+
+	lnkVolumeIDAndLocalBasePath = 0x1
+	lnkCommonNetworkRelative    = 0x2
+
+	lnkEnvironmentBlock  = 0xa0000001
+	lnkSpecialFolder     = 0xa0000005
+	lnkKnownFolder       = 0xa000000b
+	lnkVistaIDListBlock  = 0xa000000c
+	lnkEnvironmentAnsi   = 260
+	lnkEnvironmentLength = 0x314
+)
+
+var lnkCLSID = []byte{0x01, 0x14, 0x02, 0x00, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0x46}
+
+var errBadLink = errors.New("not a valid shell link")
+
+// isShortcut is true for a .lnk file, which -lnk rewrites the paths in rather than its
+// contents as text
+func isShortcut(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".lnk")
+}
+
+// shortcutPath is replace as it's written into shortcuts. windows paths use \ whatever
+// the platform, so separators are written that way
+func shortcutPath(replace string) string {
+	return strings.Map(func(r rune) rune {
+		if isSeparator(r) {
+			return '\\'
+		}
+		return r
+	}, replace)
+}
+
+// rewriteShortcut returns the shell link b with find replaced in its target, in the link
+// info and the environment variable block, and in its relative path, working directory
+// and icon location. the target's id list can't be rewritten, so when the target changes
+// it's dropped, along with the blocks that refer into it, and windows resolves the link
+// from the link info instead
+func rewriteShortcut(b []byte, replace string, m matcher) ([]byte, int, error) {
+	if len(b) < lnkHeaderSize || binary.LittleEndian.Uint32(b) != lnkHeaderSize || !bytes.Equal(b[4:20], lnkCLSID) {
+		return nil, 0, errBadLink
+	}
+
+	header := append([]byte{}, b[:lnkHeaderSize]...)
+	flags := binary.LittleEndian.Uint32(header[0x14:])
+	pos := lnkHeaderSize
+
+	var idList []byte
+	if flags&lnkHasIDList != 0 {
+		if pos+2 > len(b) {
+			return nil, 0, errBadLink
+		}
+		end := pos + 2 + int(binary.LittleEndian.Uint16(b[pos:]))
+		if end > len(b) {
+			return nil, 0, errBadLink
+		}
+		idList, pos = b[pos:end], end
+	}
+
+	matches, targetMatches := 0, 0
+
+	var linkInfo []byte
+	if flags&lnkHasLinkInfo != 0 {
+		if pos+4 > len(b) {
+			return nil, 0, errBadLink
+		}
+		end := pos + int(binary.LittleEndian.Uint32(b[pos:]))
+		if end > len(b) || end < pos+0x1c {
+			return nil, 0, errBadLink
+		}
+
+		var n int
+		var err error
+		linkInfo, n, err = rewriteLinkInfo(b[pos:end], replace, m)
+		if err != nil {
+			return nil, 0, err
+		}
+		matches += n
+		targetMatches += n
+		pos = end
+	}
+
+	unicode := flags&lnkIsUnicode != 0
+	var strs bytes.Buffer
+	for _, bit := range []uint32{lnkHasName, lnkHasRelativePath, lnkHasWorkingDir, lnkHasArguments, lnkHasIconLocation} {
+		if flags&bit == 0 {
+			continue
+		}
+
+		s, size, err := readCountedString(b[pos:], unicode)
+		if err != nil {
+			return nil, 0, err
+		}
+		pos += size
+
+		if bit != lnkHasName && bit != lnkHasArguments {
+			var n int
+			s, n = replaceString(s, replace, m)
+			matches += n
+			if bit == lnkHasRelativePath {
+				targetMatches += n
+			}
+		}
+
+		err = writeCountedString(&strs, s, unicode)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	dropIDList := targetMatches > 0 && idList != nil
+	extra, n, err := rewriteExtraData(b[pos:], replace, m, dropIDList)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches += n
+
+	if matches == 0 {
+		return b, 0, nil
+	}
+
+	if dropIDList {
+		idList = nil
+		flags &^= lnkHasIDList
+		binary.LittleEndian.PutUint32(header[0x14:], flags)
+	}
+
+	var out bytes.Buffer
+	out.Write(header)
+	out.Write(idList)
+	out.Write(linkInfo)
+	out.Write(strs.Bytes())
+	out.Write(extra)
+	return out.Bytes(), matches, nil
+}
+
+// rewriteLinkInfo rebuilds a LinkInfo structure with find replaced in its local base path
+// and common path suffix, ansi and unicode, keeping the volume id and network link as
+// they are
+func rewriteLinkInfo(info []byte, replace string, m matcher) ([]byte, int, error) {
+	u32 := func(off int) int { return int(binary.LittleEndian.Uint32(info[off:])) }
+	headerSize, liFlags := u32(4), u32(8)
+	if headerSize < 0x1c || headerSize > len(info) {
+		return nil, 0, errBadLink
+	}
+	hasUnicode := headerSize >= 0x24
+
+	block := func(off int) ([]byte, error) {
+		if off < 0 || off+4 > len(info) || u32(off) < 4 || off+u32(off) > len(info) {
+			return nil, errBadLink
+		}
+		return info[off : off+u32(off)], nil
+	}
+
+	var vol, net []byte
+	var base, suffix, baseU, suffixU string
+	var err error
+	if liFlags&lnkVolumeIDAndLocalBasePath != 0 {
+		vol, err = block(u32(12))
+		if err == nil {
+			base, err = ansiCString(info, u32(16))
+		}
+		if err == nil && hasUnicode {
+			baseU, err = unicodeCString(info, u32(28))
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if liFlags&lnkCommonNetworkRelative != 0 {
+		net, err = block(u32(20))
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	suffix, err = ansiCString(info, u32(24))
+	if err == nil && hasUnicode && u32(32) != 0 {
+		suffixU, err = unicodeCString(info, u32(32))
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matches := 0
+	for _, s := range []*string{&base, &suffix, &baseU, &suffixU} {
+		var n int
+		*s, n = replaceString(*s, replace, m)
+		matches += n
+	}
+	if matches == 0 {
+		return info, 0, nil
+	}
+
+	out := append([]byte{}, info[:headerSize]...)
+	put := func(field int, data []byte) {
+		binary.LittleEndian.PutUint32(out[field:], uint32(len(out)))
+		out = append(out, data...)
+	}
+
+	if liFlags&lnkVolumeIDAndLocalBasePath != 0 {
+		put(12, vol)
+		ansi, err := encodeAnsi(base)
+		if err != nil {
+			return nil, 0, err
+		}
+		put(16, append(ansi, 0))
+	}
+	if liFlags&lnkCommonNetworkRelative != 0 {
+		put(20, net)
+	}
+	ansi, err := encodeAnsi(suffix)
+	if err != nil {
+		return nil, 0, err
+	}
+	put(24, append(ansi, 0))
+	if hasUnicode {
+		if liFlags&lnkVolumeIDAndLocalBasePath != 0 {
+			put(28, append(encodeUTF16(baseU), 0, 0))
+		}
+		if u32(32) != 0 {
+			put(32, append(encodeUTF16(suffixU), 0, 0))
+		}
+	}
+
+	binary.LittleEndian.PutUint32(out, uint32(len(out)))
+	return out, matches, nil
+}
+
+// rewriteExtraData replaces find in the environment variable block's target and drops the
+// blocks that point into the id list when it's being dropped
+func rewriteExtraData(extra []byte, replace string, m matcher, dropIDList bool) ([]byte, int, error) {
+	var out bytes.Buffer
+	matches := 0
+	for len(extra) >= 4 {
+		size := int(binary.LittleEndian.Uint32(extra))
+		if size < 4 {
+			break // the terminal block
+		}
+		if size < 8 || size > len(extra) {
+			return nil, 0, errBadLink
+		}
+
+		block := extra[:size]
+		extra = extra[size:]
+		switch binary.LittleEndian.Uint32(block[4:]) {
+		case lnkSpecialFolder, lnkKnownFolder, lnkVistaIDListBlock:
+			if dropIDList {
+				continue
+			}
+		case lnkEnvironmentBlock:
+			if size != lnkEnvironmentLength {
+				return nil, 0, errBadLink
+			}
+
+			ansiField, unicodeField := block[8:8+lnkEnvironmentAnsi], block[8+lnkEnvironmentAnsi:]
+			ansi, err := ansiCString(ansiField, 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			uni, err := unicodeCString(unicodeField, 0)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			ansi, n := replaceString(ansi, replace, m)
+			uni, nu := replaceString(uni, replace, m)
+			if n+nu > 0 {
+				enc, err := encodeAnsi(ansi)
+				if err != nil {
+					return nil, 0, err
+				}
+				encU := encodeUTF16(uni)
+				if len(enc) >= len(ansiField) || len(encU) >= len(unicodeField) {
+					return nil, 0, errors.New("the new environment variable target is too long")
+				}
+
+				block = append([]byte{}, block...)
+				ansiField, unicodeField = block[8:8+lnkEnvironmentAnsi], block[8+lnkEnvironmentAnsi:]
+				copy(ansiField, append(enc, make([]byte, len(ansiField)-len(enc))...))
+				copy(unicodeField, append(encU, make([]byte, len(unicodeField)-len(encU))...))
+				matches += n + nu
+			}
+		}
+		out.Write(block)
+	}
+	out.Write(extra)
+	return out.Bytes(), matches, nil
+}
+
+func replaceString(s, replace string, m matcher) (string, int) {
+	if s == "" {
+		return s, 0
+	}
+	b, n := m.replaceAll([]byte(s), replace)
+	return string(b), n
+}
+
+// readCountedString reads a StringData string: a count of characters, then the
+// characters, utf-16 or ansi. it returns the string and how many bytes it took
+func readCountedString(b []byte, unicode bool) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, errBadLink
+	}
+	n := int(binary.LittleEndian.Uint16(b))
+	if !unicode {
+		if 2+n > len(b) {
+			return "", 0, errBadLink
+		}
+		s, err := decodeAnsi(b[2 : 2+n])
+		return s, 2 + n, err
+	}
+
+	if 2+n*2 > len(b) {
+		return "", 0, errBadLink
+	}
+	return decodeUTF16(b[2 : 2+n*2]), 2 + n*2, nil
+}
+
+func writeCountedString(buf *bytes.Buffer, s string, unicode bool) error {
+	var b []byte
+	var n int
+	if unicode {
+		b = encodeUTF16(s)
+		n = len(b) / 2
+	} else {
+		var err error
+		b, err = encodeAnsi(s)
+		if err != nil {
+			return err
+		}
+		n = len(b)
+	}
+	if n > 0xffff {
+		return errors.New("string too long for a shell link")
+	}
+
+	binary.Write(buf, binary.LittleEndian, uint16(n))
+	buf.Write(b)
+	return nil
+}
+
+func ansiCString(b []byte, off int) (string, error) {
+	if off < 0 || off >= len(b) {
+		return "", errBadLink
+	}
+	end := bytes.IndexByte(b[off:], 0)
+	if end == -1 {
+		return "", errBadLink
+	}
+	return decodeAnsi(b[off : off+end])
+}
+
+func unicodeCString(b []byte, off int) (string, error) {
+	if off < 0 || off >= len(b) {
+		return "", errBadLink
+	}
+	for end := off; end+1 < len(b); end += 2 {
+		if b[end] == 0 && b[end+1] == 0 {
+			return decodeUTF16(b[off:end]), nil
+		}
+	}
+	return "", errBadLink
+}
+
+// ansi strings are in the system code page, taken here to be windows-1252
+func decodeAnsi(b []byte) (string, error) {
+	return charmap.Windows1252.NewDecoder().String(string(b))
+}
+
+func encodeAnsi(s string) ([]byte, error) {
+	return charmap.Windows1252.NewEncoder().Bytes([]byte(s))
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
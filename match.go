@@ -0,0 +1,364 @@
+package gfrn
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// matcher finds the text to replace in names and file contents. reg matches just the
+// find. plain ascii finds skip it and use a byte search, case-folded unless -c, which is
+// the common case and much cheaper. with re, reg is the user's own regex and replacements
+// expand its groups.
+// with pairs, reg matches any of several finds, each replaced with its own replacement
+// and counted against the rule it came from, and ac finds them all in one pass when it
+// can. with words, only matches that are whole
+// words count, and none count that overlap a match of not
+type matcher struct {
+	reg     *regexp.Regexp
+	literal []byte
+	exact   bool
+	re      bool
+	words   bool
+	not     *regexp.Regexp
+	pairs   map[string]string
+	ac      *acMatcher
+	rules   map[string]int // index of the rule each find came from, by the same key
+	nrules  int
+}
+
+func newMatcher(find string, reg *regexp.Regexp, caseSensitive bool) matcher {
+	m := matcher{reg: reg, exact: caseSensitive}
+	if find != "" && isASCII(find) && strings.IndexFunc(find, isSeparator) == -1 {
+		m.literal = []byte(find)
+	}
+	return m
+}
+
+// newPairsMatcher matches any of the finds, longest first where they overlap, in any
+// case unless caseSensitive. from is the rule each pair came from, out of nrules. two
+// finds that only differ by case would find the same text, so they're an error unless
+// caseSensitive, or they replace it the same
+func newPairsMatcher(pairs [][2]string, from []int, nrules int, caseSensitive bool) (matcher, error) {
+	m := matcher{pairs: map[string]string{}, rules: map[string]int{}, nrules: nrules, exact: caseSensitive}
+	finds := []string{}
+	first := map[string]string{}
+	for i, p := range pairs {
+		key := m.pairKey(p[0])
+		if r, ok := m.pairs[key]; ok {
+			if r != p[1] {
+				return m, fmt.Errorf("Couldn't use both %v=%v and %v=%v, they find the same text unless -c is set", first[key], r, p[0], p[1])
+			}
+			continue
+		}
+		first[key] = p[0]
+		m.pairs[key] = p[1]
+		m.rules[m.pairKey(p[0])] = from[i]
+		finds = append(finds, p[0])
+	}
+
+	// folding case is only done for ascii, the regex does the rest
+	ascii := true
+	for _, f := range finds {
+		ascii = ascii && isASCII(f)
+	}
+	if caseSensitive || ascii {
+		m.ac = newACMatcher(finds, caseSensitive)
+	}
+
+	for i, f := range finds {
+		finds[i] = regexp.QuoteMeta(f)
+	}
+
+	sort.SliceStable(finds, func(i, j int) bool { return len(finds[i]) > len(finds[j]) })
+	pattern := strings.Join(finds, "|")
+	if !caseSensitive {
+		pattern = "(?i:" + pattern + ")"
+	}
+	m.reg = regexp.MustCompile(pattern)
+	return m, nil
+}
+
+// pairKey is how a find, or text it matched, is looked up in pairs
+func (m matcher) pairKey(s string) string {
+	if m.exact {
+		return s
+	}
+	return strings.ToLower(s)
+}
+
+// replaceAll returns b with the matches replaced, and how many there were. unless the
+// find is case sensitive, every occurrence is replaced, whatever its case
+func (m matcher) replaceAll(b []byte, replace string) ([]byte, int) {
+	if m.pairs != nil {
+		out, n, _ := m.replaceCounted(b, replace)
+		return out, n
+	}
+
+	if m.re && !m.filtered() {
+		n := len(m.reg.FindAllIndex(b, -1))
+		if n == 0 {
+			return b, 0
+		}
+		return m.reg.ReplaceAll(b, []byte(replace)), n
+	}
+
+	if m.re {
+		locs := m.keepOnly(b, m.reg.FindAllSubmatchIndex(b, -1))
+		if len(locs) == 0 {
+			return b, 0
+		}
+
+		out := make([]byte, 0, len(b))
+		last := 0
+		for _, loc := range locs {
+			out = append(out, b[last:loc[0]]...)
+			out = m.reg.Expand(out, []byte(replace), b, loc)
+			last = loc[1]
+		}
+		return append(out, b[last:]...), len(locs)
+	}
+
+	locs := m.findAll(b)
+	if len(locs) == 0 {
+		return b, 0
+	}
+
+	out := make([]byte, 0, len(b)+len(locs)*len(replace))
+	last := 0
+	for _, loc := range locs {
+		out = append(out, b[last:loc[0]]...)
+		out = append(out, replace...)
+		last = loc[1]
+	}
+	return append(out, b[last:]...), len(locs)
+}
+
+// replaceCounted is replaceAll, also counting the matches of each rule when there are
+// pairs. the counts are nil when nothing matched, or there's just the one find
+func (m matcher) replaceCounted(b []byte, replace string) ([]byte, int, []int) {
+	if m.pairs == nil {
+		out, n := m.replaceAll(b, replace)
+		return out, n, nil
+	}
+
+	locs := m.findAll(b)
+	if len(locs) == 0 {
+		return b, 0, nil
+	}
+
+	counts := make([]int, m.nrules)
+	out := make([]byte, 0, len(b))
+	last := 0
+	for _, loc := range locs {
+		key := m.pairKey(string(b[loc[0]:loc[1]]))
+		counts[m.rules[key]]++
+		out = append(out, b[last:loc[0]]...)
+		out = append(out, m.pairs[key]...)
+		last = loc[1]
+	}
+	return append(out, b[last:]...), len(locs), counts
+}
+
+// rename returns name with the matches replaced, or false if nothing matched
+func (m matcher) rename(name, replace string) (string, bool) {
+	if m.re && !m.filtered() {
+		if !m.reg.MatchString(name) {
+			return name, false
+		}
+		return m.reg.ReplaceAllString(name, replace), true
+	}
+
+	b, n := m.replaceAll([]byte(name), replace)
+	return string(b), n > 0
+}
+
+// findAll returns where in b replaceAll would replace
+func (m matcher) findAll(b []byte) [][]int {
+	if m.literal == nil && m.ac == nil && !m.filtered() {
+		return m.reg.FindAllIndex(b, -1)
+	}
+	if m.re {
+		// the user's regex may be anchored, so it can't be run again from part way in
+		return m.keepOnly(b, m.reg.FindAllIndex(b, -1))
+	}
+
+	nots := m.notRanges(b)
+	var fold *foldIndex
+	if m.literal != nil && !m.exact {
+		fold = newFoldIndex(b, m.literal)
+	}
+
+	var locs [][]int
+	for i := 0; i <= len(b); {
+		var loc []int
+		switch {
+		case m.ac != nil:
+			if start, end := m.ac.find(b, i); start != -1 {
+				loc = []int{start - i, end - i}
+			}
+		case m.literal == nil:
+			loc = m.reg.FindIndex(b[i:])
+		case m.exact:
+			if j := bytes.Index(b[i:], m.literal); j != -1 {
+				loc = []int{j, j + len(m.literal)}
+			}
+		default:
+			if j := fold.from(i); j != -1 {
+				loc = []int{j - i, j - i + len(m.literal)}
+			}
+		}
+		if loc == nil {
+			return locs
+		}
+
+		start, end := i+loc[0], i+loc[1]
+		if !m.keep(b, start, end, nots) {
+			// a shorter find may still do from here, or one starting later
+			_, size := utf8.DecodeRune(b[start:])
+			i = start + size
+			continue
+		}
+		locs = append(locs, []int{start, end})
+		if end == start {
+			end++
+		}
+		i = end
+	}
+	return locs
+}
+
+// filtered is true when some matches may not count
+func (m matcher) filtered() bool {
+	return m.words || m.not != nil
+}
+
+// keepOnly keeps the matches in locs that count
+func (m matcher) keepOnly(b []byte, locs [][]int) [][]int {
+	nots := m.notRanges(b)
+	kept := locs[:0]
+	for _, loc := range locs {
+		if m.keep(b, loc[0], loc[1], nots) {
+			kept = append(kept, loc)
+		}
+	}
+	return kept
+}
+
+// keep is true when the match b[start:end] counts: it's a whole word, with words, and
+// doesn't overlap any of nots
+func (m matcher) keep(b []byte, start, end int, nots [][]int) bool {
+	if m.words && !wholeWord(b, start, end) {
+		return false
+	}
+
+	// nots are in order and don't overlap, so the first to end after start is the only
+	// one that can overlap
+	i := sort.Search(len(nots), func(i int) bool { return nots[i][1] > start })
+	return i == len(nots) || nots[i][0] >= end && nots[i][0] > start
+}
+
+// notRanges is where in b not matches, nil without it
+func (m matcher) notRanges(b []byte) [][]int {
+	if m.not == nil {
+		return nil
+	}
+	return m.not.FindAllIndex(b, -1)
+}
+
+// wholeWord is true when b[start:end] has no word character right before or after it
+func wholeWord(b []byte, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRune(b[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(b) {
+		r, _ := utf8.DecodeRune(b[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// foldIndex is bytes.Index ignoring ascii case, for finding every sep in s in turn. it
+// jumps between candidate positions of the lower and upper case first byte with
+// bytes.IndexByte and compares from there, remembering where the next of each is, so
+// one that's rare or missing isn't searched for to the end of s again for every match
+type foldIndex struct {
+	s, sep         []byte
+	lo, up         byte
+	nextLo, nextUp int // -1 when there are no more
+}
+
+func newFoldIndex(s, sep []byte) *foldIndex {
+	f := &foldIndex{s: s, sep: sep, lo: toLowerASCII(sep[0]), up: toUpperASCII(sep[0])}
+	f.nextLo, f.nextUp = bytes.IndexByte(s, f.lo), bytes.IndexByte(s, f.up)
+	return f
+}
+
+// from returns where the first sep at or after i is, or -1. i can't go backwards
+func (f *foldIndex) from(i int) int {
+	n := len(f.sep)
+	for {
+		if f.nextLo != -1 && f.nextLo < i {
+			f.nextLo = indexByteFrom(f.s, f.lo, i)
+		}
+		if f.nextUp != -1 && f.nextUp < i {
+			f.nextUp = indexByteFrom(f.s, f.up, i)
+		}
+
+		j := f.nextLo
+		if j == -1 || (f.nextUp != -1 && f.nextUp < j) {
+			j = f.nextUp
+		}
+		if j == -1 || j+n > len(f.s) {
+			return -1
+		}
+		if bytes.EqualFold(f.s[j:j+n], f.sep) {
+			return j
+		}
+		i = j + 1
+	}
+}
+
+func indexByteFrom(s []byte, c byte, from int) int {
+	i := bytes.IndexByte(s[from:], c)
+	if i == -1 {
+		return -1
+	}
+	return from + i
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func toUpperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
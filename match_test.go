@@ -0,0 +1,126 @@
+package gfrn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceAll(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		in   string
+		out  string
+		n    int
+	}{
+		{"case insensitive", Options{Find: "Foo", Replace: "Bar"}, "foo Foo FOO", "Bar Bar Bar", 3},
+		{"case sensitive", Options{Find: "Foo", Replace: "Bar", CaseSensitive: true}, "foo Foo FOO", "foo Bar FOO", 1},
+		{"no match", Options{Find: "Foo", Replace: "Bar"}, "nothing here", "nothing here", 0},
+		{"non ascii", Options{Find: "Ünï", Replace: "X"}, "ünï Ünï", "X X", 2},
+		{"metacharacters", Options{Find: "a+b", Replace: "X"}, "aab a+b", "aab X", 1},
+		{"separators", Options{Find: "a+/b", Replace: "X"}, `aa/b a+/b a+\b`, "aa/b X X", 2},
+		{"whole word", Options{Find: "Card", Replace: "Deck", WholeWord: true}, "Card Cardinal Discard card.", "Deck Cardinal Discard Deck.", 2},
+		{"whole word case sensitive", Options{Find: "Card", Replace: "Deck", WholeWord: true, CaseSensitive: true}, "Card card", "Deck card", 1},
+		{"not", Options{Find: "Acme", Replace: "Nova", Not: "AcmeLegacy"}, "Acme AcmeLegacy acme", "Nova AcmeLegacy Nova", 2},
+		{"not whole line", Options{Find: "Acme", Replace: "Nova", Not: ".*keep.*"}, "Acme\nAcme keep\nAcme", "Nova\nAcme keep\nNova", 2},
+		{"regex", Options{Find: `v(\d+)`, Replace: "ver$1", Regex: true}, "v1 v22 vx", "ver1 ver22 vx", 2},
+		{"regex with not", Options{Find: `v(\d+)`, Replace: "ver$1", Regex: true, Not: "v2"}, "v1 v22", "ver1 v22", 1},
+		{"pairs", Options{Pairs: [][2]string{{"Alpha", "One"}, {"Beta", "Two"}}}, "alpha BETA gamma", "One Two gamma", 2},
+		{"pairs longest first", Options{Pairs: [][2]string{{"Foo", "X"}, {"FooBar", "Y"}}}, "FooBar Foo", "Y X", 2},
+		{"pairs with f", Options{Find: "Old", Replace: "New", Pairs: [][2]string{{"Other", "Else"}}}, "Old Other", "New Else", 2},
+		{"pairs whole word", Options{Pairs: [][2]string{{"Card", "Deck"}}, WholeWord: true}, "Card Cardinal", "Deck Cardinal", 1},
+		{"pairs case sensitive", Options{Pairs: [][2]string{{"OldName", "newName"}, {"oldname", "x"}}, CaseSensitive: true}, "OldName oldname OLDNAME", "newName x OLDNAME", 2},
+		{"smartcase", Options{Find: "old-name", Replace: "new-name", Smartcase: true}, "OldName old_name OLD_NAME", "NewName new_name NEW_NAME", 3},
+		{"smartcase spelled in no style", Options{Find: "XMLParser", Replace: "JSONReader", Smartcase: true}, "XMLParser xml_parser xmlParser", "JSONReader json_reader jsonReader", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := compileMatcher(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, n, _ := m.replaceCounted([]byte(tt.in), tt.opts.Replace)
+			if string(out) != tt.out || n != tt.n {
+				t.Errorf("got %q, %d; want %q, %d", out, n, tt.out, tt.n)
+			}
+		})
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		in   string
+		locs [][]int
+	}{
+		{"literal", Options{Find: "ab"}, "ab xAB", [][]int{{0, 2}, {4, 6}}},
+		{"overlapping", Options{Find: "aa"}, "aaa", [][]int{{0, 2}}},
+		{"whole word", Options{Find: "ab", WholeWord: true}, "ab abc ab", [][]int{{0, 2}, {7, 9}}},
+		{"not", Options{Find: "ab", Not: "abc"}, "abc ab", [][]int{{4, 6}}},
+		{"pairs", Options{Pairs: [][2]string{{"a", "1"}, {"bc", "2"}}}, "xbca", [][]int{{1, 3}, {3, 4}}},
+		{"none", Options{Find: "zz"}, "abc", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := compileMatcher(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			locs := m.findAll([]byte(tt.in))
+			if !reflect.DeepEqual(locs, tt.locs) {
+				t.Errorf("got %v, want %v", locs, tt.locs)
+			}
+		})
+	}
+}
+
+func TestReplaceCountedRules(t *testing.T) {
+	opts := Options{Find: "Old", Replace: "New", Pairs: [][2]string{{"Alpha", "One"}, {"Unused", "None"}}}
+	m, _, err := compileMatcher(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, n, counts := m.replaceCounted([]byte("old alpha Old"), opts.Replace)
+	if n != 3 || !reflect.DeepEqual(counts, []int{2, 1, 0}) {
+		t.Errorf("got %d, %v; want 3, [2 1 0]", n, counts)
+	}
+}
+
+func TestPairsCaseCollision(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		fails bool
+	}{
+		{"different replacements", Options{Pairs: [][2]string{{"OldName", "newName"}, {"oldname", "x"}}}, true},
+		{"same replacement", Options{Pairs: [][2]string{{"OldName", "x"}, {"oldname", "x"}}}, false},
+		{"case sensitive", Options{Pairs: [][2]string{{"OldName", "newName"}, {"oldname", "x"}}, CaseSensitive: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := compileMatcher(tt.opts)
+			if (err != nil) != tt.fails {
+				t.Errorf("got error %v, want one: %v", err, tt.fails)
+			}
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	m, _, err := compileMatcher(Options{Find: "Foo", Replace: "Bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, ok := m.rename("FooService.cs", "Bar"); !ok || name != "BarService.cs" {
+		t.Errorf("got %q, %v; want BarService.cs, true", name, ok)
+	}
+	if _, ok := m.rename("Other.cs", "Bar"); ok {
+		t.Errorf("renamed Other.cs")
+	}
+}
@@ -0,0 +1,78 @@
+package gfrn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlanLine is a line a plan changes, as it was and as it becomes, so the change can still
+// be made to a file that's been edited since the plan was
+type PlanLine struct {
+	Line int    `json:"line"` // from 1
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// planLines lists the lines before and after differ in. it's nil when the replacement
+// adds or takes away lines, as those changes can't be merged a line at a time
+func planLines(before, after []byte) []PlanLine {
+	lines := strings.Split(string(before), "\n")
+	changed := strings.Split(string(after), "\n")
+	if len(lines) != len(changed) {
+		return nil
+	}
+
+	list := []PlanLine{}
+	for i, line := range lines {
+		if line != changed[i] {
+			list = append(list, PlanLine{Line: i + 1, Old: line, New: changed[i]})
+		}
+	}
+	return list
+}
+
+// mergeLines makes a plan's line changes to b, a file edited since the plan was made, a
+// three way merge with the lines as planned from as the base. each line is changed where
+// it was, or where the same line is nearest to that if the edits moved it, and is left
+// when it's already as planned. it returns the result, and the conflicts needing a
+// person to look at them instead: planned lines that were edited themselves, and matches
+// of m the plan doesn't know about
+func mergeLines(b []byte, plan []PlanLine, m matcher) ([]byte, []string) {
+	lines := strings.Split(string(b), "\n")
+	done := map[int]bool{} // lines made as planned, or already that way
+	conflicts := []string{}
+
+	for _, pl := range plan {
+		i := nearestLine(lines, pl.Line-1, pl.Old, done)
+		if i != -1 {
+			lines[i] = pl.New
+			done[i] = true
+			continue
+		}
+		if i = nearestLine(lines, pl.Line-1, pl.New, done); i != -1 {
+			done[i] = true
+			continue
+		}
+		conflicts = append(conflicts, fmt.Sprintf("line %d was edited: %s", pl.Line, strings.TrimSpace(pl.Old)))
+	}
+
+	for i, line := range lines {
+		if !done[i] && len(m.findAll([]byte(line))) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("line %d has a match the plan doesn't: %s", i+1, strings.TrimSpace(line)))
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), conflicts
+}
+
+// nearestLine is the index of the line that's text closest to i, skipping those done,
+// or -1 when there's none
+func nearestLine(lines []string, i int, text string, done map[int]bool) int {
+	for d := 0; d <= i || i+d < len(lines); d++ {
+		for _, j := range []int{i - d, i + d} {
+			if j >= 0 && j < len(lines) && !done[j] && lines[j] == text {
+				return j
+			}
+		}
+	}
+	return -1
+}
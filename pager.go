@@ -0,0 +1,53 @@
+package gfrn
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// page writes review output to the run's output, through $PAGER (less by default, like
+// git) when that's a terminal and the output wouldn't fit on it
+func (e *Engine) page(out []byte) {
+	e.console.flush()
+
+	f, ok := e.console.w.(*os.File)
+	if !ok || !isTerminal(f) || bytes.Count(out, []byte("\n")) < terminalRows(f) {
+		e.console.w.Write(out)
+		return
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+		if runtime.GOOS == "windows" {
+			pager = "more"
+		}
+	}
+
+	args := strings.Fields(pager)
+	if len(args) == 0 || args[0] == "cat" {
+		f.Write(out)
+		return
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(out)
+	cmd.Stdout = f
+	cmd.Stderr = os.Stderr
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+
+	if err := cmd.Run(); err != nil {
+		f.Write(out)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,104 @@
+package gfrn
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParsePair splits s into the old and new of a pair at sep
+func ParsePair(s, sep string) ([2]string, error) {
+	old, nw, ok := strings.Cut(s, sep)
+	if !ok || old == "" {
+		return [2]string{}, fmt.Errorf("%q isn't old%snew", s, sep)
+	}
+	return [2]string{old, nw}, nil
+}
+
+// ruleList is every find and replace the run was given: f and r if given, then each pair
+func ruleList(opts Options) [][2]string {
+	rules := [][2]string{}
+	if opts.Find != "" {
+		rules = append(rules, [2]string{opts.Find, opts.Replace})
+	}
+	return append(rules, opts.Pairs...)
+}
+
+// findPairs is what the run finds and replaces for rules, with smartcase each spelled in
+// every identifier style, and the index of the rule each pair came from
+func findPairs(rules [][2]string, smartcase bool) ([][2]string, []int) {
+	from := []int{}
+	if !smartcase {
+		for i := range rules {
+			from = append(from, i)
+		}
+		return rules, from
+	}
+
+	variants := [][2]string{}
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		for _, v := range caseVariants(rule[0], rule[1]) {
+			if !seen[v[0]] {
+				seen[v[0]] = true
+				variants = append(variants, v)
+				from = append(from, i)
+			}
+		}
+	}
+	return variants, from
+}
+
+// LoadMapFile reads pairs from a file: two column rows when it's a .csv or .tsv, old=new
+// lines otherwise. blank lines and lines starting with # are skipped
+func LoadMapFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".csv" || ext == ".tsv" {
+		r := csv.NewReader(f)
+		r.Comment = '#'
+		r.FieldsPerRecord = 2
+		if ext == ".tsv" {
+			r.Comma = '\t'
+			r.LazyQuotes = true
+		}
+
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+
+		pairs := [][2]string{}
+		for _, rec := range records {
+			if rec[0] == "" {
+				return nil, fmt.Errorf("%v has a row with nothing to find", path)
+			}
+			pairs = append(pairs, [2]string{rec[0], rec[1]})
+		}
+		return pairs, nil
+	}
+
+	pairs := [][2]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pair, err := ParsePair(line, "=")
+		if err != nil {
+			return nil, fmt.Errorf("%v line %d, %s", path, n, err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, sc.Err()
+}
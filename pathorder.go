@@ -0,0 +1,89 @@
+package gfrn
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// pathOrder sorts paths for people reading a report: grouped by directory, with a
+// directory's own files before its subdirectories, and names in the collation order of
+// the user's locale with runs of digits compared by value, so file2 comes before file10.
+// a collator isn't safe to share between goroutines, so each sort makes its own
+type pathOrder struct {
+	col *collate.Collator
+}
+
+func newPathOrder() pathOrder {
+	return pathOrder{col: collate.New(userLanguage(), collate.Numeric)}
+}
+
+// sortByPath sorts list, a slice, by the path of each element
+func sortByPath(list interface{}, path func(i int) string) {
+	po := newPathOrder()
+	sort.SliceStable(list, func(i, j int) bool { return po.less(path(i), path(j)) })
+}
+
+func (po pathOrder) less(a, b string) bool {
+	da, na := splitPath(a)
+	db, nb := splitPath(b)
+	if c := po.compareDirs(da, db); c != 0 {
+		return c < 0
+	}
+	if c := po.col.CompareString(na, nb); c != 0 {
+		return c < 0
+	}
+	return a < b
+}
+
+// compareDirs compares directories a name at a time, so a directory comes right before
+// the ones in it
+func (po pathOrder) compareDirs(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	as, bs := strings.FieldsFunc(a, isSeparator), strings.FieldsFunc(b, isSeparator)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := po.col.CompareString(as[i], bs[i]); c != 0 {
+			return c
+		}
+		if as[i] != bs[i] {
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// splitPath splits p, with either separator, into its directory and name
+func splitPath(p string) (string, string) {
+	i := strings.LastIndexAny(p, "/"+string(filepath.Separator))
+	return p[:i+1], p[i+1:]
+}
+
+// userLanguage is the language to collate in from LC_ALL, LC_COLLATE or LANG, like
+// en_US.UTF-8, or the root collation when none is set or it's C or POSIX
+func userLanguage() language.Tag {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+
+		if i := strings.IndexAny(v, ".@"); i != -1 {
+			v = v[:i]
+		}
+		if v == "C" || v == "POSIX" {
+			return language.Und
+		}
+		if tag, err := language.Parse(v); err == nil {
+			return tag
+		}
+		return language.Und
+	}
+	return language.Und
+}
@@ -0,0 +1,118 @@
+package gfrn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plan describes a run: the renames it makes and the content it changes. All paths are
+// relative to Dir, use forward slashes and are given as they were before any renames.
+// A rename of Dir itself is recorded with Old "." and New as the new directory name.
+// The rest is what Apply needs to make the content changes again: what is found, what it's
+// replaced with and how.
+type Plan struct {
+	Dir     string     `json:"dir"`
+	Renames []RenameOp `json:"renames"`
+	Files   []PlanFile `json:"files"`
+
+	Find          string      `json:"find,omitempty"`
+	Replace       string      `json:"replace,omitempty"`
+	Pairs         [][2]string `json:"pairs,omitempty"`
+	CaseSensitive bool        `json:"caseSensitive,omitempty"`
+	Regex         bool        `json:"regex,omitempty"`
+	Smartcase     bool        `json:"smartcase,omitempty"`
+	WholeWord     bool        `json:"wholeWord,omitempty"`
+	Not           string      `json:"not,omitempty"`
+	Charset       string      `json:"charset,omitempty"`
+	EOL           string      `json:"eol,omitempty"` // lf or crlf every changed file is given, as -eol
+}
+
+type PlanFile struct {
+	Path    string     `json:"path"`
+	OldHash string     `json:"oldHash"`
+	NewHash string     `json:"newHash"`
+	Matches int        `json:"matches,omitempty"`
+	Lines   []PlanLine `json:"lines,omitempty"` // what changes, to merge into the file if it's edited before it's applied
+}
+
+func LoadPlan(path string) (Plan, error) {
+	var plan Plan
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return plan, err
+	}
+
+	err = json.Unmarshal(b, &plan)
+	return plan, err
+}
+
+// root returns the directory the plan's relative paths resolve against once it has been applied
+func (plan Plan) root() string {
+	for _, rn := range plan.Renames {
+		if rn.Old == "." {
+			return filepath.Join(filepath.Dir(plan.Dir), rn.New)
+		}
+	}
+	return plan.Dir
+}
+
+// finalPath maps a pre-rename relative path to where it lives after every rename in the plan
+func (plan Plan) finalPath(rel string) string {
+	m := make(map[string]string, len(plan.Renames))
+	for _, rn := range plan.Renames {
+		m[rn.Old] = rn.New
+	}
+
+	oldPrefix, newPrefix := "", ""
+	for _, c := range strings.Split(rel, "/") {
+		oldPrefix = joinSlash(oldPrefix, c)
+		name := c
+		if n, ok := m[oldPrefix]; ok {
+			name = n[strings.LastIndex(n, "/")+1:]
+		}
+		newPrefix = joinSlash(newPrefix, name)
+	}
+	return newPrefix
+}
+
+// relRenames is renames the way a plan records them
+func relRenames(dir string, renames []RenameOp) []RenameOp {
+	list := []RenameOp{}
+	for _, rn := range renames {
+		old, nw := relSlash(dir, rn.Old), relSlash(dir, rn.New)
+		if rn.Old == dir {
+			nw = filepath.Base(rn.New)
+		}
+		list = append(list, RenameOp{Old: old, New: nw, Dir: rn.Dir})
+	}
+	return list
+}
+
+// absRenames is a plan's renames under dir, the way a run makes them
+func absRenames(dir string, renames []RenameOp) []RenameOp {
+	list := []RenameOp{}
+	for _, rn := range renames {
+		old, nw := filepath.Join(dir, filepath.FromSlash(rn.Old)), filepath.Join(dir, filepath.FromSlash(rn.New))
+		if rn.Old == "." {
+			old, nw = dir, filepath.Join(filepath.Dir(dir), rn.New)
+		}
+		list = append(list, RenameOp{Old: old, New: nw, Dir: rn.Dir})
+	}
+	return list
+}
+
+func joinSlash(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "/" + b
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package gfrn
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// precheck looks for everything the run would need to read or change but can't, before
+// anything is changed: directories it can't list, text files it can't read or write, and
+// directories it can't create or rename entries in because they hold text files or names
+// that match. with skip the problems are excluded from the run rather than stopping it
+func (e *Engine) precheck(dir string, reg *regexp.Regexp, wf *walkFilter, skip bool) error {
+	problems := []AccessProblem{}
+	checked := map[string]bool{}
+	needWrite := func(d string) {
+		if checked[d] {
+			return
+		}
+		checked[d] = true
+		if !writableDir(d) {
+			problems = append(problems, AccessProblem{d, "can't write"})
+		}
+	}
+
+	e.progress.phase(PhaseCheck)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			problems = append(problems, AccessProblem{path, "can't read"})
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if wf.skipDir(path, d) || wf.excludedPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if reg.MatchString(d.Name()) {
+			needWrite(filepath.Dir(path))
+		}
+
+		if !wf.textFile(path, d) {
+			return nil
+		}
+		needWrite(filepath.Dir(path))
+
+		if f, err := os.Open(path); err != nil {
+			problems = append(problems, AccessProblem{path, "can't read"})
+		} else {
+			f.Close()
+		}
+		if f, err := os.OpenFile(path, os.O_WRONLY, 0); err != nil {
+			problems = append(problems, AccessProblem{path, "can't write"})
+		} else {
+			f.Close()
+		}
+		return nil
+	})
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, p := range problems {
+		e.console.println(p.What, p.Path)
+	}
+
+	if !skip {
+		return &AccessError{Problems: problems}
+	}
+
+	for _, p := range problems {
+		wf.excludeFiles[p.Path] = true
+		e.skips.add(p.Path, p.What)
+	}
+	e.console.println("Skipping", len(problems), "paths that can't be read or written")
+	return nil
+}
@@ -0,0 +1,53 @@
+package gfrn
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// preview prints, for every text file the run would change, the first few lines that would
+// change with the replacement applied. nothing is written. long previews go through the pager
+func (e *Engine) preview(dir, replace string, lines int, m matcher, wf *walkFilter) {
+	reads := e.brokerRead(e.walkTextFiles(dir, wf), wf, false)
+	sortByPath(reads, func(i int) string { return reads[i].Path })
+
+	var out bytes.Buffer
+	files := 0
+	for _, rd := range reads {
+		wr, ok := e.updateFile(rd, m, replace)
+		if !ok {
+			continue
+		}
+		files++
+
+		fmt.Fprintln(&out, rd.Path)
+		writeChangedLines(&out, rd.Contents, wr.Contents, 1, lines)
+	}
+
+	fmt.Fprintln(&out, files, "files would change")
+	e.page(out.Bytes())
+}
+
+// writeChangedLines writes up to n of the lines that differ between before and after, each
+// with its line number, counting from first, and then as it is after
+func writeChangedLines(w io.Writer, before, after []byte, first, n int) {
+	shown := 0
+	lines := strings.Split(string(before), "\n")
+	changed := strings.Split(string(after), "\n")
+	for i, line := range lines {
+		if i >= len(changed) || line == changed[i] {
+			continue
+		}
+
+		if shown == n {
+			fmt.Fprintln(w, "    ...")
+			return
+		}
+		shown++
+
+		fmt.Fprintf(w, "  %d: %s\n", i+first, strings.TrimSpace(line))
+		fmt.Fprintf(w, "  %s→ %s\n", strings.Repeat(" ", len(fmt.Sprint(i+first))), strings.TrimSpace(changed[i]))
+	}
+}
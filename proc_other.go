@@ -0,0 +1,16 @@
+//go:build !unix
+
+package gfrn
+
+import "os"
+
+// processAlive is true when a process with pid is running. on windows FindProcess opens
+// the process, so it fails when there isn't one
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package gfrn
+
+import "syscall"
+
+// processAlive is true when a process with pid is running, even one we can't signal
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,152 @@
+package gfrn
+
+import (
+	"sync"
+	"time"
+)
+
+// Phase is what part of its work a run is in
+type Phase string
+
+const (
+	PhaseFind     Phase = "find"     // walking the tree for names to rename
+	PhaseCheck    Phase = "check"    // reading files to check the run before changing anything
+	PhaseRename   Phase = "rename"   // renaming
+	PhaseContents Phase = "contents" // reading, replacing in and writing text files
+	PhaseDone     Phase = "done"
+)
+
+// Progress is how far a run has got, for a gui or server to show while it works. the file
+// counts count from the start of the phase, Renames from the start of the run. done comes
+// with the counts the last phase ended on. once WalkDone, Scanned against Walked is how
+// far through the phase's files it is
+type Progress struct {
+	Phase    Phase  `json:"phase"`
+	Path     string `json:"path,omitempty"` // what was just read, renamed or written
+	Renames  int    `json:"renames"`
+	Walked   int    `json:"walked"` // what the walk has found, just text files in the content pass
+	WalkDone bool   `json:"walkDone"`
+	Scanned  int    `json:"scanned"` // text files read, or tried
+	Bytes    int64  `json:"bytes"`   // read from them
+	Changed  int    `json:"changed"` // files sent to be rewritten
+	Matches  int    `json:"matches"` // in those files
+}
+
+// tracker calls its func with each change, one call at a time and in order, so the func
+// needn't be safe for concurrent use. it's called from the workers, so it should be quick
+// it also times the phases, whether anyone's listening or not
+type tracker struct {
+	mu sync.Mutex
+	fn func(Progress)
+	p  Progress
+
+	phases []Phase // in the order they first started
+	times  map[Phase]time.Duration
+	since  time.Time // when the phase started
+}
+
+// PhaseTime is how long a run spent in a phase, over all the times it was in it
+type PhaseTime struct {
+	Phase   Phase  `json:"phase"`
+	Elapsed string `json:"elapsed"`
+}
+
+func (t *tracker) start(fn func(Progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fn, t.p = fn, Progress{}
+	t.phases, t.times, t.since = nil, map[Phase]time.Duration{}, time.Time{}
+}
+
+// lap adds the time since the phase started to its total, and starts phase
+func (t *tracker) lap(phase Phase) {
+	now := time.Now()
+	if t.times == nil {
+		t.times = map[Phase]time.Duration{}
+	}
+	if t.p.Phase != "" && t.p.Phase != PhaseDone {
+		if _, ok := t.times[t.p.Phase]; !ok {
+			t.phases = append(t.phases, t.p.Phase)
+		}
+		t.times[t.p.Phase] += now.Sub(t.since)
+	}
+	t.p.Phase, t.since = phase, now
+}
+
+// timings is how long each phase has taken so far, in the order they first started
+func (t *tracker) timings() []PhaseTime {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lap(t.p.Phase)
+
+	list := []PhaseTime{}
+	for _, phase := range t.phases {
+		list = append(list, PhaseTime{Phase: phase, Elapsed: t.times[phase].String()})
+	}
+	return list
+}
+
+// update changes the progress with f and sends it on, if anyone's listening
+func (t *tracker) update(f func(p *Progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fn == nil {
+		return
+	}
+	f(&t.p)
+	t.fn(t.p)
+}
+
+// phase starts phase, with its counts at zero
+func (t *tracker) phase(phase Phase) {
+	t.mu.Lock()
+	t.lap(phase)
+	t.mu.Unlock()
+
+	t.update(func(p *Progress) {
+		*p = Progress{Phase: phase, Renames: p.Renames}
+	})
+}
+
+// finish says the run's done, with the last phase's counts, and stops sending
+func (t *tracker) finish() {
+	t.update(func(p *Progress) {
+		p.Phase, p.Path = PhaseDone, ""
+	})
+	t.start(nil)
+}
+
+func (t *tracker) walked() {
+	t.update(func(p *Progress) {
+		p.Walked++
+	})
+}
+
+func (t *tracker) walkDone() {
+	t.update(func(p *Progress) {
+		p.WalkDone = true
+	})
+}
+
+func (t *tracker) scanned(path string, size int64) {
+	t.update(func(p *Progress) {
+		p.Path = path
+		p.Scanned++
+		p.Bytes += size
+	})
+}
+
+func (t *tracker) renamed(path string) {
+	t.update(func(p *Progress) {
+		p.Path = path
+		p.Renames++
+	})
+}
+
+func (t *tracker) changed(path string, matches int) {
+	t.update(func(p *Progress) {
+		p.Path = path
+		p.Changed++
+		p.Matches += matches
+	})
+}
@@ -0,0 +1,150 @@
+package gfrn
+
+import (
+	"bytes"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Suspect is a match that looks like it shouldn't be replaced, e.g. one inside a url
+type Suspect struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+	Text   string `json:"text"` // what the match is part of
+}
+
+var guidReg = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// quarantine holds back files with suspicious matches from the content pass, so they're
+// only rewritten once confirm says so
+type quarantine struct {
+	confirm  func([]Suspect) bool
+	console  *consoleWriter
+	skips    *skipLog
+	held     []ReadOp
+	large    []string // held back files that are streamed, so not held in memory
+	suspects []Suspect
+}
+
+// hold keeps rd back when any of its matches look suspicious. it's called from a single
+// goroutine, the one feeding the updaters
+func (q *quarantine) hold(rd ReadOp, m matcher) bool {
+	found := suspicious(rd.Path, rd.Contents, m)
+	if len(found) == 0 {
+		return false
+	}
+	q.held = append(q.held, rd)
+	q.suspects = append(q.suspects, found...)
+	return true
+}
+
+// holdLarge keeps back the streamed file at path, which has suspects
+func (q *quarantine) holdLarge(path string, suspects []Suspect) {
+	q.large = append(q.large, path)
+	q.suspects = append(q.suspects, suspects...)
+}
+
+// release lists what was held back and asks whether to go ahead with it
+func (q *quarantine) release() bool {
+	sortByPath(q.suspects, func(i int) string { return q.suspects[i].Path })
+	for _, s := range q.suspects {
+		q.console.printf("quarantined %v:%d %v in %q\n", s.Path, s.Line, s.Reason, s.Text)
+	}
+	q.console.flush()
+
+	if q.confirm == nil || !q.confirm(q.suspects) {
+		q.console.println(len(q.held)+len(q.large), "quarantined files were left alone")
+		for _, rd := range q.held {
+			q.skips.add(rd.Path, "quarantined")
+		}
+		for _, path := range q.large {
+			q.skips.add(path, "quarantined")
+		}
+		return false
+	}
+	return true
+}
+
+// suspicious returns the matches in b that are inside a url, a guid or a base64 blob, or on
+// a line that looks binary, where a replacement is most likely to break something
+func suspicious(path string, b []byte, m matcher) []Suspect {
+	list := []Suspect{}
+	for _, loc := range m.findAll(b) {
+		start, end := loc[0], loc[1]
+		ls := bytes.LastIndexByte(b[:start], '\n') + 1
+		le := len(b)
+		if i := bytes.IndexByte(b[end:], '\n'); i != -1 {
+			le = end + i
+		}
+		line := b[ls:le]
+		s, e := start-ls, end-ls
+
+		reason, text := "", ""
+		ts, te := expand(line, s, e, isTokenByte)
+		token := line[ts:te]
+		switch {
+		case binaryLine(line):
+			reason, text = "binary", string(line[s:e])
+		case bytes.Contains(token, []byte("://")) || bytes.HasPrefix(bytes.ToLower(token), []byte("www.")):
+			reason, text = "url", string(token)
+		default:
+			for _, g := range guidReg.FindAllIndex(line, -1) {
+				if g[0] < e && s < g[1] {
+					reason, text = "guid", string(line[g[0]:g[1]])
+					break
+				}
+			}
+			if reason == "" {
+				bs, be := expand(line, s, e, isBase64Byte)
+				if blob := line[bs:be]; len(blob) >= 40 && bytes.ContainsAny(blob, "0123456789") {
+					reason, text = "base64", string(blob)
+				}
+			}
+		}
+
+		if reason == "" {
+			continue
+		}
+		if len(text) > 60 {
+			text = text[:57] + "..."
+		}
+		list = append(list, Suspect{Path: path, Line: bytes.Count(b[:ls], []byte("\n")) + 1, Reason: reason, Text: text})
+	}
+	return list
+}
+
+// expand grows [s, e) in line both ways over bytes in, as long as the match itself is in
+func expand(line []byte, s, e int, in func(byte) bool) (int, int) {
+	for i := s; i < e; i++ {
+		if !in(line[i]) {
+			return s, e
+		}
+	}
+	for s > 0 && in(line[s-1]) {
+		s--
+	}
+	for e < len(line) && in(line[e]) {
+		e++
+	}
+	return s, e
+}
+
+func isTokenByte(c byte) bool {
+	return c > ' ' && bytes.IndexByte([]byte(`"'<>()[]{},;`+"`"), c) == -1
+}
+
+func isBase64Byte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '+' || c == '/' || c == '='
+}
+
+// binaryLine is a line with control characters other than tabs and carriage returns in it,
+// or that isn't valid utf-8
+func binaryLine(line []byte) bool {
+	for _, c := range line {
+		if c < ' ' && c != '\t' && c != '\r' && c != '\f' || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.Valid(line)
+}
@@ -0,0 +1,180 @@
+package gfrn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeRenameMap writes where every renamed path ended up to path, for tools that fix up
+// references gfrn doesn't know about, like ide projects, ci path filters and link checkers.
+// paths have slashes and are relative to dir before the run and to newpath, where dir
+// ended up, after it, in the order the walk found them, so directories come before what's
+// in them. a .json path gets a json list of old, new and dir, anything else a line per
+// rename of old and new, tab separated, with directories ending in /
+func writeRenameMap(path, dir, newpath string, renames []RenameOp) error {
+	renamed := renameMap(renames)
+	list := []RenameOp{}
+	for _, rn := range renames {
+		if rn.Old == dir {
+			continue
+		}
+		list = append(list, RenameOp{Old: relSlash(dir, rn.Old), New: relSlash(newpath, renamedPath(renamed, rn.Old)), Dir: rn.Dir})
+	}
+
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		b, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	} else {
+		for _, rn := range list {
+			old, nw := rn.Old, rn.New
+			if rn.Dir {
+				old, nw = old+"/", nw+"/"
+			}
+			fmt.Fprintf(&buf, "%s\t%s\n", old, nw)
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// loadRenameMap reads a map like writeRenameMap writes, from anywhere, into renames of the
+// tree at dir, in the order a run makes them. renames don't move things between
+// directories, so each new path has to be its old one renamed in place, in its parent as
+// the map leaves that
+func loadRenameMap(path, dir string) ([]RenameOp, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []RenameOp{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &entries)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for n, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			old, nw, ok := strings.Cut(line, "\t")
+			if !ok {
+				return nil, fmt.Errorf("line %d has no tab between the old and new path", n+1)
+			}
+			entries = append(entries, RenameOp{Old: old, New: nw})
+		}
+	}
+
+	renamed := map[string]string{}
+	for i, rn := range entries {
+		old, nw := mapPath(dir, rn.Old), mapPath(dir, rn.New)
+		if old == "" || nw == "" {
+			return nil, fmt.Errorf("%v -> %v has to be two paths inside dir", rn.Old, rn.New)
+		}
+		entries[i] = RenameOp{Old: old, New: nw}
+		renamed[old] = nw
+	}
+
+	renames := []RenameOp{}
+	for _, rn := range entries {
+		if rn.Old == rn.New {
+			continue
+		}
+
+		if filepath.Dir(rn.New) != renamedPath(renamed, filepath.Dir(rn.Old)) {
+			return nil, fmt.Errorf("%v -> %v moves it to another directory, only renames in place can be made", relSlash(dir, rn.Old), relSlash(dir, rn.New))
+		}
+
+		info, err := os.Lstat(rn.Old)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, RenameOp{Old: rn.Old, New: filepath.Join(filepath.Dir(rn.Old), filepath.Base(rn.New)), Dir: info.IsDir()})
+	}
+
+	sortByPath(renames, func(i int) string { return renames[i].Old })
+	return renames, nil
+}
+
+// mapPath is p from a rename map, relative to dir with either separator, under dir, or ""
+// when it isn't inside dir
+func mapPath(dir, p string) string {
+	p = filepath.Clean(nativeSeparators(p))
+	if p == "." || filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.Join(dir, p)
+}
+
+// runRenameMap makes just the renames in the map at opts.ImportRenames, through the same
+// conflict checks, confirmation, journal and version control as a run's own renames
+func (e *Engine) runRenameMap(ctx context.Context, opts Options, sum *Report) error {
+	if opts.Dir == "" {
+		return fmt.Errorf("Dir must be specified and non-blank")
+	}
+	if err := validOnConflict(opts.OnConflict); err != nil {
+		return err
+	}
+
+	renames, err := loadRenameMap(opts.ImportRenames, opts.Dir)
+	if err != nil {
+		return fmt.Errorf("Couldn't load rename map %v, %s", opts.ImportRenames, err)
+	}
+
+	renames, err = e.resolveConflicts(renames, opts.OnConflict)
+	if err != nil {
+		return err
+	}
+	sum.Renames = renames
+
+	if opts.Dry {
+		for _, rn := range renames {
+			e.console.println("rename", rn.Old, "->", rn.New)
+		}
+		e.console.println(len(renames), "renames would be made, nothing was changed")
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lock, err := e.lockRun(opts.Dir, opts.Takeover)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	if opts.Ask != nil {
+		renames = (&asker{ask: opts.Ask, console: e.console, skips: e.skips}).renames(renames)
+		sum.Renames = renames
+	}
+
+	newpath, _, err := e.makeRenames(ctx, opts, nil, renames, sum)
+	lock.moved(newpath)
+	if err != nil {
+		return err
+	}
+
+	if opts.ExportRenames != "" {
+		err = writeRenameMap(opts.ExportRenames, opts.Dir, newpath, renames)
+		if err != nil {
+			return fmt.Errorf("Couldn't export renames to %v, %s", opts.ExportRenames, err)
+		}
+	}
+
+	e.console.println("Renamed", len(renames), "paths from", opts.ImportRenames)
+	return nil
+}
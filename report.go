@@ -0,0 +1,78 @@
+package gfrn
+
+import "sync"
+
+// Report is what a run did, for wrappers to read as json from -report-file or
+// -report-fd rather than picking it out of the human output on stdout
+type Report struct {
+	Dir     string       `json:"dir"`
+	Find    string       `json:"find"`
+	Replace string       `json:"replace"`
+	Renames []RenameOp   `json:"renames"`
+	Files   []ReportFile `json:"files"`
+	Exts    []*ExtStats  `json:"exts"`
+	Rules   []*RuleStats `json:"rules,omitempty"`
+	Matches int          `json:"matches"`
+	Found   []Found      `json:"found,omitempty"`
+	Totals  Totals       `json:"totals"`
+	Elapsed string       `json:"elapsed"`
+
+	Skipped     []SkippedPath `json:"skipped"`
+	Quarantined []Suspect     `json:"quarantined,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// ReportFile is a file whose contents were replaced, and how many times
+type ReportFile struct {
+	Path    string `json:"path"`
+	Matches int    `json:"matches"`
+}
+
+func (sum *Report) addWrites(writes []WriteOp) {
+	for _, wr := range writes {
+		sum.Files = append(sum.Files, ReportFile{Path: wr.Path, Matches: wr.Matches})
+		sum.Matches += wr.Matches
+		for i, n := range wr.Rules {
+			if n > 0 && i < len(sum.Rules) {
+				sum.Rules[i].Files++
+				sum.Rules[i].Matches += n
+			}
+		}
+	}
+	sortByPath(sum.Files, func(i int) string { return sum.Files[i].Path })
+}
+
+// SkippedPath is a file the run meant to rename or rewrite and didn't, and why
+type SkippedPath struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Err    error  `json:"-"` // what went wrong, when something did rather than it being left out
+}
+
+type skipLog struct {
+	mu   sync.Mutex
+	list []SkippedPath
+}
+
+func (l *skipLog) add(path, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list = append(l.list, SkippedPath{Path: path, Reason: reason})
+}
+
+// fail records path as skipped because of err
+func (l *skipLog) fail(path string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list = append(l.list, SkippedPath{Path: path, Reason: err.Error(), Err: err})
+}
+
+// take returns what's been skipped, in report order, and empties the log
+func (l *skipLog) take() []SkippedPath {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := l.list
+	l.list = nil
+	sortByPath(list, func(i int) string { return list[i].Path })
+	return list
+}
@@ -0,0 +1,171 @@
+package gfrn
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// retryQueue collects the files the content pass couldn't read or write, to try again once
+// the rest are done, which gets most of them through a network share's hiccups. a run turns
+// it on for its content pass, and what isn't retried is skipped
+type retryQueue struct {
+	skips *skipLog
+
+	mu    sync.Mutex
+	on    bool
+	tries int           // rounds of retrying
+	wait  time.Duration // before the first round, doubling each round after
+	list  []retry
+}
+
+// retry is a file to read again, or when write is set, to write again
+type retry struct {
+	path  string
+	write *WriteOp
+	err   error
+}
+
+// start turns the queue on for tries rounds, none leaving it off
+func (q *retryQueue) start(tries int, wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.on, q.tries, q.wait, q.list = tries > 0, tries, wait, nil
+}
+
+// read queues path to be read again, or when there's no retrying it, skips it
+func (q *retryQueue) read(path string, err error) {
+	if !q.add(retry{path: path, err: err}) {
+		q.skips.fail(path, err)
+	}
+}
+
+// write queues wr to be written again, as it was before it was encoded, or skips it
+func (q *retryQueue) write(wr WriteOp, err error) {
+	if !q.add(retry{path: wr.Path, write: &wr, err: err}) {
+		q.skips.fail(wr.Path, err)
+	}
+}
+
+// add is false when r won't be retried: the queue's off, or r can't have been a passing
+// problem, like a file it has no permission for
+func (q *retryQueue) add(r retry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.on || errors.Is(r.err, fs.ErrPermission) {
+		return false
+	}
+	q.list = append(q.list, r)
+	return true
+}
+
+func (q *retryQueue) take() []retry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := q.list
+	q.list = nil
+	return list
+}
+
+// lastRound turns the queue off, so what fails from now on is skipped
+func (q *retryQueue) lastRound() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.on = false
+}
+
+// putBack returns list to the queue, untried
+func (q *retryQueue) putBack(list []retry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.list = append(list, q.list...)
+}
+
+// stop turns the queue off and skips whatever's still in it, with the error it last failed with
+func (q *retryQueue) stop() {
+	q.lastRound()
+	for _, r := range q.take() {
+		q.skips.fail(r.path, r.err)
+	}
+}
+
+// retryFailed has another go at the files that failed, a round at a time, waiting longer
+// before each. files that failed to read go through the content pass as they would have
+// the first time, and are returned with all the files written. writes that failed are
+// written again without backing the file up, it's been backed up already. what fails
+// in the last round is skipped
+func (e *Engine) retryFailed(dir, replace string, m matcher, budget time.Duration, wf *walkFilter, w writer, j *journal, a *asker) ([]ReadOp, []WriteOp, error) {
+	defer e.retries.stop()
+
+	var scanned []ReadOp
+	var writes []WriteOp
+	wait := e.retries.wait
+	for round := 0; round < e.retries.tries; round++ {
+		list := e.retries.take()
+		if len(list) == 0 {
+			break
+		}
+		if round == e.retries.tries-1 {
+			// nothing more is retried, so what fails is skipped straight away
+			e.retries.lastRound()
+		}
+
+		e.console.println("Retrying", len(list), "files that failed in", wait)
+		if !sleep(wf, wait) {
+			e.retries.putBack(list)
+			break
+		}
+		wait *= 2
+
+		paths := make(chan string, len(list))
+		again := make(chan WriteOp, len(list))
+		for _, r := range list {
+			if r.write != nil {
+				again <- *r.write
+			} else {
+				paths <- r.path
+			}
+		}
+		close(paths)
+		close(again)
+
+		more, err := e.brokerWrite(again, w, nil, dir)
+		writes = append(writes, more...)
+		if err != nil {
+			return scanned, writes, err
+		}
+
+		reads := make(chan ReadOp, e.workers)
+		go func() {
+			defer close(reads)
+			for rd := range e.streamRead(paths, wf, false) {
+				scanned = append(scanned, ReadOp{Path: rd.Path})
+				reads <- rd
+			}
+		}()
+		more, err = e.brokerWrite(a.filter(e.streamUpdate(reads, m, replace, budget)), w, j, dir)
+		writes = append(writes, more...)
+		if err != nil {
+			return scanned, writes, err
+		}
+	}
+	return scanned, writes, nil
+}
+
+// sleep waits for d, false when the run's told to stop first
+func sleep(wf *walkFilter, d time.Duration) bool {
+	if wf.ctx == nil {
+		time.Sleep(d)
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-wf.ctx.Done():
+		return false
+	}
+}
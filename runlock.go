@@ -0,0 +1,141 @@
+package gfrn
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// runLockName is the lock a run holds on its tree while changing it, under journalDir so
+// walks skip it
+const runLockName = "run.lock"
+
+// a run touches its lock every heartbeatEvery, so one that hasn't been touched for
+// staleAfter was left by a run that died, even on another host sharing the tree
+const (
+	heartbeatEvery = 10 * time.Second
+	staleAfter     = time.Minute
+)
+
+// runLock keeps other runs out of a tree while one is changing it. the file says who took
+// it, and its mtime is the heartbeat
+type runLock struct {
+	lockOwner
+	tookOver int // pid of the dead run whose lock this replaced, 0 for none
+
+	mu      sync.Mutex
+	path    string
+	stop    chan struct{}
+	console *consoleWriter
+}
+
+// lockOwner is what's written in the lock
+type lockOwner struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// lockRun takes the run lock on dir. a lock left behind by a run that's gone stops the run
+// unless takeover, when it's replaced, and the dead run's pid kept for scavenging
+func (e *Engine) lockRun(dir string, takeover bool) (*runLock, error) {
+	host, _ := os.Hostname()
+	l := &runLock{lockOwner: lockOwner{PID: os.Getpid(), Host: host, Started: time.Now()}, path: filepath.Join(dir, journalDir, runLockName), stop: make(chan struct{}), console: e.console}
+
+	err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = json.NewEncoder(f).Encode(l.lockOwner)
+			f.Close()
+			if err != nil {
+				os.Remove(l.path)
+				return nil, err
+			}
+			go l.heartbeat()
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		old, idle, err := readRunLock(l.path)
+		if os.IsNotExist(err) {
+			continue // its run just finished
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read the lock %v, %s", l.path, err)
+		}
+
+		alive := idle < staleAfter && (old.Host != host || processAlive(old.PID))
+		if alive || !takeover || l.tookOver == old.PID {
+			return nil, &RunLockedError{Dir: dir, Path: l.path, PID: old.PID, Host: old.Host, Started: old.Started, Idle: idle, Stale: !alive}
+		}
+
+		e.console.println("Taking over the lock left by gfrn pid", old.PID, "on", old.Host)
+		err = os.Remove(l.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l.tookOver = old.PID
+	}
+}
+
+// readRunLock reads the lock at path, and how long it's been since it was touched
+func readRunLock(path string) (lockOwner, time.Duration, error) {
+	var l lockOwner
+	info, err := os.Stat(path)
+	if err != nil {
+		return l, 0, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return l, 0, err
+	}
+	// a lock cut off by a crash while it was written is as good as dead
+	json.Unmarshal(b, &l)
+	return l, time.Since(info.ModTime()), nil
+}
+
+func (l *runLock) heartbeat() {
+	t := time.NewTicker(heartbeatEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-t.C:
+			l.mu.Lock()
+			os.Chtimes(l.path, now, now)
+			l.mu.Unlock()
+		}
+	}
+}
+
+// moved points the lock at where it is once dir has been renamed to root
+func (l *runLock) moved(root string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = filepath.Join(root, journalDir, runLockName)
+}
+
+// release removes the lock, and journalDir with it when nothing else is in there
+func (l *runLock) release() {
+	close(l.stop)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := os.Remove(l.path)
+	if err != nil {
+		l.console.println("Couldn't remove the lock", l.path, err)
+	}
+	os.Remove(filepath.Dir(l.path))
+}
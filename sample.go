@@ -0,0 +1,50 @@
+package gfrn
+
+import (
+	"math/rand"
+	"time"
+)
+
+// sample runs the read and update phases over a random subset of the text files without
+// writing anything, and extrapolates what a full run would change and how long it would take.
+// renames only need the walk, so they are counted exactly
+func (e *Engine) sample(dir, replace string, rate float64, files int, renames []RenameOp, m matcher, budget time.Duration, wf *walkFilter) {
+	total := 0
+	picked := []string{}
+	for path := range e.walkTextFiles(dir, wf) {
+		total++
+		if files > 0 {
+			// reservoir sample, every file has the same chance of ending up in the sample
+			if len(picked) < files {
+				picked = append(picked, path)
+			} else if j := rand.Intn(total); j < files {
+				picked[j] = path
+			}
+		} else if rand.Float64() < rate {
+			picked = append(picked, path)
+		}
+	}
+
+	start := time.Now()
+
+	paths := make(chan string, len(picked))
+	for _, p := range picked {
+		paths <- p
+	}
+	close(paths)
+
+	e.progress.phase(PhaseCheck)
+	reads := e.brokerRead(paths, wf, false)
+	writes := e.brokerUpdate(reads, m, replace, budget)
+	elapsed := time.Since(start)
+
+	e.console.println("Sampled", len(picked), "of", total, "files in", elapsed)
+	e.console.println("  renames:", len(renames))
+	if len(picked) == 0 {
+		return
+	}
+
+	scale := float64(total) / float64(len(picked))
+	e.console.printf("  files that would change: %d (est. %d)\n", len(writes), int(float64(len(writes))*scale+0.5))
+	e.console.println("  estimated content pass:", time.Duration(float64(elapsed)*scale).Round(time.Millisecond))
+}
@@ -0,0 +1,55 @@
+package gfrn
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// scavenge removes temp files left behind by runs that died part way through an atomic
+// write, from dir's tree and from the temp dir. ones whose run is still going are left
+// alone, so runs side by side don't pull each other's temp files out from under them.
+// those of the run with pid dead, whose lock was taken over, go whatever has its pid now
+func (e *Engine) scavenge(dir string, t tempNames, wf *walkFilter, dead int) {
+	check := func(path, name string) {
+		pid, ok := t.pidOf(name)
+		if !ok || pid != dead && processAlive(pid) {
+			return
+		}
+
+		err := os.Remove(path)
+		if err != nil {
+			e.console.println("Couldn't remove leftover temp file", path, err)
+			return
+		}
+		e.console.println("Removed leftover temp file", path)
+	}
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if wf.skipDir(path, d) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			check(path, d.Name())
+		}
+		return nil
+	})
+
+	if t.dir == "" {
+		return
+	}
+
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		e.console.println("Couldn't read temp dir", t.dir, err)
+		return
+	}
+	for _, de := range entries {
+		if !de.IsDir() {
+			check(filepath.Join(t.dir, de.Name()), de.Name())
+		}
+	}
+}
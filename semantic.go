@@ -0,0 +1,125 @@
+package gfrn
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// semanticRename renames the identifier find to replace in the go files under dir through
+// gopls, which renames each declaration along with every reference to it and leaves
+// unrelated strings alone. files are rescanned after every rename since one rename can
+// reach many files. occurrences gopls won't rename (package names, imported or builtin
+// names) are reported and left. the go files are then left out of the content pass.
+// gopls writes the files itself, so with a journal every go file with find in it, which
+// are all it could touch, is backed up first, under where renames will put it
+func (e *Engine) semanticRename(dir, find, replace string, wf *walkFilter, j *journal, renames []RenameOp) error {
+	if !token.IsIdentifier(find) || !token.IsIdentifier(replace) {
+		return fmt.Errorf("-semantic needs f and r to be identifiers")
+	}
+
+	gopls, err := exec.LookPath("gopls")
+	if err != nil {
+		return fmt.Errorf("-semantic needs gopls on the PATH, %s", err)
+	}
+
+	files := []string{}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if wf.skipDir(path, d) || wf.excludedPath(path) && d.IsDir() {
+			return filepath.SkipDir
+		}
+		if strings.HasSuffix(d.Name(), ".go") && wf.textFile(path, d) {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	if j != nil {
+		root := dir
+		moved := renameMap(renames)
+		if len(renames) > 0 && renames[0].Old == dir {
+			root = renames[0].New
+		}
+		for _, file := range files {
+			offsets, err := identOffsets(file, find)
+			if err != nil {
+				return err
+			}
+			if len(offsets) == 0 {
+				continue
+			}
+			err = j.keep(file, relSlash(root, renamedPath(moved, file)))
+			if err != nil {
+				return fmt.Errorf("Couldn't back up %v to the journal, %s", file, err)
+			}
+		}
+		err = j.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	renamed, skipped := 0, 0
+	for _, file := range files {
+		// occurrences that failed stay put, ahead of the ones still to try
+		failed := 0
+		for {
+			offsets, err := identOffsets(file, find)
+			if err != nil {
+				return err
+			}
+			if failed >= len(offsets) {
+				break
+			}
+
+			cmd := exec.Command(gopls, "rename", "-w", fmt.Sprintf("%s:#%d", file, offsets[failed]), replace)
+			cmd.Dir = filepath.Dir(file)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				e.console.println("gopls couldn't rename", find, "at", fmt.Sprintf("%s:#%d", file, offsets[failed]), strings.TrimSpace(string(out)))
+				failed++
+				skipped++
+				continue
+			}
+			renamed++
+		}
+	}
+
+	wf.noGo = true
+	e.console.println("gopls renamed", renamed, "declarations,", skipped, "occurrences left as they are")
+	return nil
+}
+
+// identOffsets returns the byte offset of every identifier named name in a go file
+func identOffsets(path, name string) ([]int, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile(path, -1, len(src))
+
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+
+	offsets := []int{}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && lit == name {
+			offsets = append(offsets, file.Offset(pos))
+		}
+	}
+	return offsets, nil
+}
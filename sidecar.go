@@ -0,0 +1,87 @@
+package gfrn
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addSidecars follows each file rename with renames of its companion files, the ones next
+// to it with the same stem and another suffix from its group, e.g. Foo.Designer.cs and
+// Foo.resx with Foo.cs in the group .cs,.Designer.cs,.resx, so they stay together even when
+// their own names don't match. suffixes are matched in any case, the longest first
+func addSidecars(renames []RenameOp, groups [][]string, wf *walkFilter) []RenameOp {
+	if len(groups) == 0 {
+		return renames
+	}
+
+	renamed := map[string]bool{}
+	for _, rn := range renames {
+		renamed[rn.Old] = true
+	}
+	listings := map[string][]os.DirEntry{}
+
+	list := []RenameOp{}
+	for _, rn := range renames {
+		list = append(list, rn)
+		if rn.Dir {
+			continue
+		}
+
+		oldName, newName := filepath.Base(rn.Old), filepath.Base(rn.New)
+		for _, group := range groups {
+			suffix := longestSuffix(oldName, group)
+			if suffix == "" || !strings.EqualFold(longestSuffix(newName, group), suffix) {
+				continue
+			}
+			oldStem, newStem := oldName[:len(oldName)-len(suffix)], newName[:len(newName)-len(suffix)]
+
+			dir := filepath.Dir(rn.Old)
+			entries, ok := listings[dir]
+			if !ok {
+				entries, _ = os.ReadDir(dir)
+				listings[dir] = entries
+			}
+
+			for _, e := range entries {
+				name := e.Name()
+				if e.IsDir() || !strings.HasPrefix(name, oldStem) || wf.ignoredName(name) {
+					continue
+				}
+				rest := name[len(oldStem):]
+				if strings.EqualFold(rest, suffix) || !hasSuffixFold(group, rest) {
+					continue
+				}
+
+				path := filepath.Join(dir, name)
+				if renamed[path] || wf.excludedPath(path) {
+					continue
+				}
+				renamed[path] = true
+				list = append(list, RenameOp{Old: path, New: filepath.Join(dir, newStem+rest)})
+			}
+		}
+	}
+	return list
+}
+
+// longestSuffix returns the longest of suffixes that name ends with, in any case, as name
+// spells it, or "" for none. a name that is only the suffix has no stem and doesn't count
+func longestSuffix(name string, suffixes []string) string {
+	found := ""
+	for _, s := range suffixes {
+		if len(s) > len(found) && len(name) > len(s) && strings.EqualFold(name[len(name)-len(s):], s) {
+			found = name[len(name)-len(s):]
+		}
+	}
+	return found
+}
+
+func hasSuffixFold(suffixes []string, s string) bool {
+	for _, suffix := range suffixes {
+		if strings.EqualFold(suffix, s) {
+			return true
+		}
+	}
+	return false
+}
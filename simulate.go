@@ -0,0 +1,91 @@
+package gfrn
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// simulateInto carries the run out in out rather than in dir. every directory is created
+// there under its new name, along with the files that would be renamed or rewritten, as
+// they would be afterwards. dir itself is left alone
+func (e *Engine) simulateInto(out, dir, replace string, renames []RenameOp, m matcher, budget time.Duration, wf *walkFilter, sum *Report) error {
+	rel, err := filepath.Rel(dir, out)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%v is inside %v", out, dir)
+	}
+
+	renamed := renameMap(renames)
+	root := renamedPath(renamed, dir)
+	dest := func(path string) string {
+		return filepath.Join(out, filepath.FromSlash(relSlash(root, renamedPath(renamed, path))))
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if wf.skipDir(path, d) || wf.excludedPath(path) {
+			return filepath.SkipDir
+		}
+		return os.MkdirAll(dest(path), os.ModePerm)
+	})
+	if err != nil {
+		return err
+	}
+
+	e.progress.phase(PhaseContents)
+	reads := e.brokerRead(e.walkTextFiles(dir, wf), wf, false)
+	writes := e.brokerUpdate(reads, m, replace, budget)
+
+	copied := map[string]bool{}
+	for _, wr := range writes {
+		contents, err := encodeContents(wr.Contents, wr.Charset)
+		if err != nil {
+			return fmt.Errorf("Couldn't encode %v back to %v, %s", wr.Path, wr.Charset, err)
+		}
+
+		err = copyInto(dest(wr.Path), wr.Path, contents)
+		if err != nil {
+			return err
+		}
+		copied[wr.Path] = true
+	}
+
+	for _, rn := range renames {
+		if rn.Dir || copied[rn.Old] {
+			continue
+		}
+
+		contents, err := os.ReadFile(rn.Old)
+		if err != nil {
+			return err
+		}
+		err = copyInto(dest(rn.Old), rn.Old, contents)
+		if err != nil {
+			return err
+		}
+		copied[rn.Old] = true
+	}
+
+	sum.addWrites(writes)
+	sum.Exts = statsByExt(reads, writes)
+
+	e.console.println("Simulated into", out+",", len(copied), "files written,", dir, "is unchanged")
+	return nil
+}
+
+// copyInto writes contents to path with the mode of the file at src
+func copyInto(path, src string, contents []byte) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, info.Mode().Perm())
+}
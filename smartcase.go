@@ -0,0 +1,82 @@
+package gfrn
+
+import (
+	"strings"
+	"unicode"
+)
+
+// caseVariants spells find and replace in each common identifier style, so renaming
+// old-name to new-name also takes OldName to NewName, oldName to newName, OLD_NAME to
+// NEW_NAME and so on. find and replace as given come first, as they're spelled in no style
+// when they're like XMLParser, and where two styles spell find the same, the first one's
+// replace wins
+func caseVariants(find, replace string) [][2]string {
+	fw, rw := splitWords(find), splitWords(replace)
+	styles := []func([]string) string{
+		func(w []string) string { return strings.Join(w, "-") },
+		func(w []string) string { return strings.Join(w, "_") },
+		func(w []string) string { return strings.ToUpper(strings.Join(w, "_")) },
+		camelCase,
+		pascalCase,
+	}
+
+	pairs := [][2]string{{find, replace}}
+	seen := map[string]bool{find: true}
+	for _, style := range styles {
+		f := style(fw)
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		pairs = append(pairs, [2]string{f, style(rw)})
+	}
+	return pairs
+}
+
+// splitWords breaks a name into lower case words at separators and case changes, so
+// old-name, old_name, oldName and OLDName all give old and name
+func splitWords(s string) []string {
+	words := []string{}
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case r == '-' || r == '_' || unicode.IsSpace(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+func camelCase(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return words[0] + pascalCase(words[1:])
+}
+
+func pascalCase(words []string) string {
+	var sb strings.Builder
+	for _, w := range words {
+		rs := []rune(w)
+		sb.WriteRune(unicode.ToUpper(rs[0]))
+		sb.WriteString(string(rs[1:]))
+	}
+	return sb.String()
+}
@@ -0,0 +1,154 @@
+package gfrn
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// writeSnapshot archives every file that the run is about to rename or rewrite into a zip
+// at path, under files/, along with layout.txt (every path in the tree before renaming)
+// and renames.txt (old and new path of every rename, tab separated). files over -max-size
+// to stream are searched a chunk at a time and copied in the same way
+func (e *Engine) writeSnapshot(path, dir string, renames []RenameOp, reg *regexp.Regexp, m matcher, wf *walkFilter) error {
+	affected := map[string]bool{}
+	list := []string{}
+	add := func(p string) {
+		if _, ok := affected[p]; ok {
+			return
+		}
+		affected[p] = true
+		list = append(list, p)
+	}
+
+	for _, rn := range renames {
+		if !rn.Dir {
+			add(rn.Old)
+		}
+	}
+
+	for rd := range e.streamRead(e.walkTextFiles(dir, wf), wf, false) {
+		if reg.Match(rd.Contents) {
+			add(rd.Path)
+		}
+	}
+	for _, p := range wf.largeFiles() {
+		ok, err := streamMatches(p, m)
+		if err != nil {
+			return fmt.Errorf("Couldn't search %v, %s", p, err)
+		}
+		if ok {
+			add(p)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	layout := []string{}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if wf.skipDir(p, d) {
+			return filepath.SkipDir
+		}
+
+		rel := relSlash(dir, p)
+		if d.IsDir() {
+			rel += "/"
+		}
+		layout = append(layout, rel)
+		return nil
+	})
+
+	err = writeZipText(zw, "layout.txt", layout)
+	if err != nil {
+		return err
+	}
+
+	renameLines := []string{}
+	for _, rn := range renames {
+		renameLines = append(renameLines, relSlash(dir, rn.Old)+"\t"+relSlash(dir, rn.New))
+	}
+
+	err = writeZipText(zw, "renames.txt", renameLines)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range list {
+		err = writeZipFile(zw, "files/"+relSlash(dir, p), p)
+		if err != nil {
+			return fmt.Errorf("Couldn't archive %v, %s", p, err)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeZipText(zw *zip.Writer, name string, lines []string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		_, err = io.WriteString(w, line+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZipFile(zw *zip.Writer, name, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(w, src)
+	return err
+}
+
+func relSlash(base, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
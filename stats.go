@@ -0,0 +1,229 @@
+package gfrn
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+type ExtStats struct {
+	Ext     string `json:"ext"`
+	Files   int    `json:"files"`
+	Changed int    `json:"changed"`
+	Matches int    `json:"matches"`
+}
+
+// statsByExt breaks files scanned, files changed and matches replaced down by extension,
+// most matches first
+func statsByExt(reads []ReadOp, writes []WriteOp) []*ExtStats {
+	m := map[string]*ExtStats{}
+	get := func(path string) *ExtStats {
+		ext := filepath.Ext(strings.ToLower(path))
+		st, ok := m[ext]
+		if !ok {
+			st = &ExtStats{Ext: ext}
+			m[ext] = st
+		}
+		return st
+	}
+
+	for _, rd := range reads {
+		get(rd.Path).Files++
+	}
+
+	for _, wr := range writes {
+		st := get(wr.Path)
+		st.Changed++
+		st.Matches += wr.Matches
+	}
+
+	list := []*ExtStats{}
+	for _, st := range m {
+		list = append(list, st)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Matches != list[j].Matches {
+			return list[i].Matches > list[j].Matches
+		}
+		return list[i].Ext < list[j].Ext
+	})
+	return list
+}
+
+// printExts prints sum's files scanned and changed and matches for each extension to w, with
+// each one's share of the matches, when anything matched. detail, for -stats, adds the
+// files renamed and skipped and the matches per changed file, and prints it regardless
+func (sum *Report) printExts(w io.Writer, detail bool) {
+	total := 0
+	for _, st := range sum.Exts {
+		total += st.Matches
+	}
+	if total == 0 && !detail {
+		return
+	}
+
+	list := append([]*ExtStats{}, sum.Exts...)
+	renamed, skipped := map[string]int{}, map[string]int{}
+	seen := map[string]bool{}
+	for _, st := range list {
+		seen[st.Ext] = true
+	}
+	more := func(path string, counts map[string]int) {
+		ext := filepath.Ext(strings.ToLower(path))
+		counts[ext]++
+		if !seen[ext] {
+			seen[ext] = true
+			list = append(list, &ExtStats{Ext: ext})
+		}
+	}
+	if detail {
+		for _, rn := range sum.Renames {
+			if !rn.Dir {
+				more(rn.Old, renamed)
+			}
+		}
+		for _, s := range sum.Skipped {
+			more(s.Path, skipped)
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if !detail {
+		fmt.Fprintln(tw, "ext\tfiles\tchanged\tmatches\t%\t")
+		for _, st := range list {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f\t\n", st.Ext, st.Files, st.Changed, st.Matches, float64(st.Matches)*100/float64(total))
+		}
+		tw.Flush()
+		return
+	}
+
+	fmt.Fprintln(tw, "ext\tfiles\tchanged\tmatches\trenamed\tskipped\tmatches/file\t")
+	for _, st := range list {
+		per := 0.0
+		if st.Changed > 0 {
+			per = float64(st.Matches) / float64(st.Changed)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f\t\n", st.Ext, st.Files, st.Changed, st.Matches, renamed[st.Ext], skipped[st.Ext], per)
+	}
+	tw.Flush()
+}
+
+// RuleStats is what one of several finds and replaces did, so rules in a long lived map
+// file that no longer match anything stand out
+type RuleStats struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+	Renames int    `json:"renames"`
+	Files   int    `json:"files"`
+	Matches int    `json:"matches"`
+}
+
+// Totals is what a run did in all, for the summary at the end
+type Totals struct {
+	Scanned      int         `json:"scanned"` // text files read in the content pass
+	Matched      int         `json:"matched"` // of them, the ones with something to replace
+	Changed      int         `json:"changed"` // files rewritten
+	Failed       int         `json:"failed"`  // files skipped for an error, after any retries
+	DirsRenamed  int         `json:"dirsRenamed"`
+	FilesRenamed int         `json:"filesRenamed"`
+	Replacements int         `json:"replacements"`
+	BytesWritten int64       `json:"bytesWritten"`
+	Phases       []PhaseTime `json:"phases"`
+}
+
+// counts are what the workers of the content pass do, for the totals. each content pass
+// starts them over, so the checks before it aren't counted
+type counts struct {
+	matched, written, bytes atomic.Int64
+}
+
+func (c *counts) reset() {
+	c.matched.Store(0)
+	c.written.Store(0)
+	c.bytes.Store(0)
+}
+
+func (c *counts) wrote(n int64) {
+	c.written.Add(1)
+	c.bytes.Add(n)
+}
+
+// total fills in sum's totals from what it has, the run's tally and its timings
+func (sum *Report) total(tally *counts, timings []PhaseTime) {
+	t := Totals{
+		Matched:      int(tally.matched.Load()),
+		Changed:      int(tally.written.Load()),
+		Replacements: sum.Matches,
+		BytesWritten: tally.bytes.Load(),
+		Phases:       timings,
+	}
+	for _, st := range sum.Exts {
+		t.Scanned += st.Files
+	}
+	for _, s := range sum.Skipped {
+		if s.Err != nil {
+			t.Failed++
+		}
+	}
+	for _, rn := range sum.Renames {
+		if rn.Dir {
+			t.DirsRenamed++
+		} else {
+			t.FilesRenamed++
+		}
+	}
+	sum.Totals = t
+}
+
+// ruleStats starts the stats for rules, nil when there's only the one
+func ruleStats(rules [][2]string) []*RuleStats {
+	if len(rules) < 2 {
+		return nil
+	}
+
+	list := []*RuleStats{}
+	for _, rule := range rules {
+		list = append(list, &RuleStats{Find: rule[0], Replace: rule[1]})
+	}
+	return list
+}
+
+// endRules counts the renames against the rules that made them, the contents having been
+// counted as the files were written, then prints the stats to w
+func (sum *Report) endRules(w io.Writer, m matcher, replace string) {
+	for _, rn := range sum.Renames {
+		_, _, counts := m.replaceCounted([]byte(filepath.Base(rn.Old)), replace)
+		for i, n := range counts {
+			if n > 0 {
+				sum.Rules[i].Renames++
+			}
+		}
+	}
+	printRuleStats(w, sum.Rules)
+}
+
+// printRuleStats lists each rule in the order given, and then the ones that did nothing
+func printRuleStats(w io.Writer, list []*RuleStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "rule\trenames\tfiles\tmatches")
+	unused := []string{}
+	for _, st := range list {
+		fmt.Fprintf(tw, "%s -> %s\t%d\t%d\t%d\n", st.Find, st.Replace, st.Renames, st.Files, st.Matches)
+		if st.Renames == 0 && st.Matches == 0 {
+			unused = append(unused, st.Find)
+		}
+	}
+	tw.Flush()
+
+	if len(unused) > 0 {
+		fmt.Fprintln(w, len(unused), "of", len(list), "rules matched nothing:", strings.Join(unused, ", "))
+	}
+}
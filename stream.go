@@ -0,0 +1,367 @@
+package gfrn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// streamChunk is about how much of a streamed file is held in memory at once
+const streamChunk = 1 << 20
+
+// streamOverlap is how far from the end a chunk cut part way through a line is cut, at
+// the least, so a find shorter than it running on past the end isn't split
+const streamOverlap = 4096
+
+// chunker reads a file in chunks of about streamChunk that end at the end of a line, so no
+// match within a line is split between two. a line longer than that is cut where m finds
+// nothing across the cut, just after a byte that isn't part of a word
+type chunker struct {
+	r     *bufio.Reader
+	m     matcher
+	buf   []byte
+	carry []byte // the rest of a line that was cut
+	line  int    // the line the last chunk starts on, from 1
+	lines int
+}
+
+func newChunker(r io.Reader, m matcher) *chunker {
+	return &chunker{r: bufio.NewReaderSize(r, streamChunk), m: m, lines: 1}
+}
+
+// head is the start of the file, for sniffing what it is
+func (c *chunker) head() []byte {
+	b, _ := c.r.Peek(sniffLen)
+	return b
+}
+
+// next returns the next chunk, good until the call after, or io.EOF after the last one
+func (c *chunker) next() ([]byte, error) {
+	c.buf = append(c.buf[:0], c.carry...)
+	c.carry = c.carry[:0]
+
+	var err error
+	for len(c.buf) < streamChunk {
+		var line []byte
+		line, err = c.r.ReadSlice('\n')
+		c.buf = append(c.buf, line...)
+		if err == bufio.ErrBufferFull {
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+
+	if err == nil && c.buf[len(c.buf)-1] != '\n' {
+		cut := c.cut(c.buf)
+		c.carry = append(c.carry, c.buf[cut:]...)
+		c.buf = c.buf[:cut]
+	}
+	c.line = c.lines
+	c.lines += bytes.Count(c.buf, []byte("\n"))
+	return c.buf, nil
+}
+
+// cut is where to end a chunk that stops part way through a line: after a byte that
+// can't be part of a word, so whole words are still whole, outside any match, at least
+// streamOverlap from the end. a line with nowhere like that in the back half of the chunk
+// is cut at the end, and a match across the cut missed
+func (c *chunker) cut(b []byte) int {
+	locs := c.m.findAll(b)
+	for i := len(b) - streamOverlap; i > len(b)/2; i-- {
+		if !cuttable(b[i-1]) {
+			continue
+		}
+		j := sort.Search(len(locs), func(j int) bool { return locs[j][1] > i })
+		if j == len(locs) || locs[j][0] >= i {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// cuttable is true for ascii bytes that aren't part of a word or a crlf
+func cuttable(c byte) bool {
+	return c < utf8.RuneSelf && c != '\r' && c != '\n' && !isWordRune(rune(c))
+}
+
+// streamMatches is whether m finds anything in the file at path, read a chunk at a time
+func streamMatches(path string, m matcher) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	c := newChunker(f, m)
+	for {
+		b, err := c.next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if len(m.findAll(b)) > 0 {
+			return true, nil
+		}
+	}
+}
+
+// replaceChunk is updateFile for a chunk of a streamed file
+func replaceChunk(b []byte, m matcher, replace string) ([]byte, int, []int) {
+	out, n, rules := m.replaceCounted(b, replace)
+	if n == 0 {
+		return b, 0, nil
+	}
+	return keepLineEnding(b, out), n, rules
+}
+
+// streamScan is what a read through a streamed file found: how many matches, in all and
+// for each rule, the first lines they change and the ones that look suspicious
+type streamScan struct {
+	matches  int
+	rules    []int
+	diff     string
+	suspects []Suspect
+}
+
+// scanStream reads through the file at path a chunk at a time, counting what the run would
+// replace in it, with the first changes as a diff and the suspicious ones when asked for.
+// files the content pass would leave out have no matches. ones in a charset other than
+// utf-8, or that a handler rewrites, can't be streamed
+func scanStream(path string, m matcher, replace string, wf *walkFilter, diff, suspects bool) (streamScan, error) {
+	var scan streamScan
+	f, err := os.Open(path)
+	if err != nil {
+		return scan, err
+	}
+	defer f.Close()
+
+	c := newChunker(f, m)
+	head := c.head()
+	if wf.detectText && !wf.looksText(path) || wf.excludedType(head) {
+		return scan, nil
+	}
+
+	charset := wf.charset
+	if charset == "auto" {
+		charset = detectCharset(head)
+		if !strings.HasPrefix(charset, "utf-16") {
+			charset = "" // searched as bytes, as a file that can't be decoded is
+		}
+	}
+	if charset != "" && charset != "utf-8" {
+		return scan, fmt.Errorf("it's %v, only utf-8 can be streamed", charset)
+	}
+	if handlerFor(path, head) != nil {
+		return scan, fmt.Errorf("its handler needs the whole file, so it can't be streamed")
+	}
+
+	marked := wf.ifContains == nil
+	for {
+		b, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return scan, err
+		}
+		marked = marked || wf.ifContains.Match(b)
+
+		out, n, rules := replaceChunk(b, m, replace)
+		if n == 0 {
+			continue
+		}
+		scan.matches += n
+		if rules != nil && scan.rules == nil {
+			scan.rules = make([]int, len(rules))
+		}
+		for i, r := range rules {
+			scan.rules[i] += r
+		}
+
+		if diff && scan.diff == "" {
+			var buf bytes.Buffer
+			writeChangedLines(&buf, b, out, c.line, diffLines)
+			scan.diff = buf.String()
+		}
+		if suspects {
+			for _, s := range suspicious(path, b, m) {
+				s.Line += c.line - 1
+				scan.suspects = append(scan.suspects, s)
+			}
+		}
+	}
+
+	if !marked {
+		return streamScan{}, nil
+	}
+	return scan, nil
+}
+
+// streamFiles replaces in files over -max-size, with -stream-large, a chunk at a time
+// rather than reading each whole into memory. each is read through first, to count its
+// matches and to quarantine and ask about it as the content pass would, then read again
+// into a temp file that's renamed over it, so they're always written atomically
+func (e *Engine) streamFiles(paths []string, m matcher, replace string, wf *walkFilter, w writer, j *journal, q *quarantine, a *asker, root string) ([]WriteOp, error) {
+	done := []WriteOp{}
+	for _, path := range paths {
+		if wf.stopped() {
+			break
+		}
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		e.progress.scanned(path, size)
+
+		// replacing the file would cut it off from its other hardlinks, and it can't be
+		// rewritten in place a chunk at a time
+		if info, err := os.Lstat(path); err == nil {
+			if _, links, ok := linksOf(info); ok && links > 1 {
+				e.console.println("Skipping", path, "it's over -max-size and hardlinked, so it can't be streamed")
+				e.skips.add(path, "over max size and hardlinked")
+				continue
+			}
+		}
+
+		scan, err := scanStream(path, m, replace, wf, a != nil, q != nil)
+		if err != nil {
+			e.console.println("Couldn't stream", path, err)
+			e.skips.fail(path, err)
+			continue
+		}
+		if scan.matches == 0 {
+			continue
+		}
+
+		if q != nil && len(scan.suspects) > 0 {
+			q.holdLarge(path, scan.suspects)
+			continue
+		}
+		e.tally.matched.Add(1)
+		if a != nil && (a.quit || !a.all && !a.yes(Change{Path: path, Diff: scan.diff})) {
+			e.skips.add(path, "declined")
+			continue
+		}
+
+		if j != nil {
+			err := j.backup(root, []WriteOp{{Path: path}})
+			if err != nil {
+				return done, err
+			}
+		}
+
+		e.console.println("Streaming", path, "it's over -max-size")
+		err = e.writeStream(path, m, replace, w)
+		if err != nil {
+			e.console.println("Got error writing file", path, err)
+			e.skips.fail(path, err)
+			continue
+		}
+		done = append(done, WriteOp{Path: path, Matches: scan.matches, Rules: scan.rules})
+		e.progress.changed(path, scan.matches)
+	}
+	return done, nil
+}
+
+// writeStream is writeAtomic for a streamed file, replacing in it a chunk at a time as
+// it's copied to the temp file
+func (e *Engine) writeStream(path string, m matcher, replace string, w writer) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if w.lock {
+		err = lockFile(in)
+		if err != nil {
+			e.console.println("Couldn't lock", path, err)
+		}
+	}
+
+	mode := w.mode
+	if info, err := in.Stat(); err == nil && mode == 0 {
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	streams, _ := altStreams(path)
+
+	dir := w.temp.dirFor(path)
+	f, name, err := createTemp(dir, w.temp)
+	if err != nil {
+		return err
+	}
+
+	err = fillStream(f, in, m, replace, mode, w)
+	if err == nil {
+		name, err = linkTemp(f, dir, name, w.temp)
+	}
+	f.Close()
+
+	if err == nil {
+		e.keepStreams(path, name, streams)
+		err = os.Rename(name, path)
+	}
+
+	if err != nil {
+		if name != "" {
+			os.Remove(name)
+		}
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		e.tally.wrote(info.Size())
+	}
+
+	if w.fsync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// fillStream copies in to f with the matches replaced, then gives f its mode and flushes
+// it as fillTemp does
+func fillStream(f, in *os.File, m matcher, replace string, mode os.FileMode, w writer) error {
+	bw := bufio.NewWriterSize(f, streamChunk)
+	c := newChunker(in, m)
+	for {
+		b, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		out, _, _ := replaceChunk(b, m, replace)
+		if w.eol != "" {
+			out = setLineEnding(out, w.eol)
+		}
+		_, err = bw.Write(out)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := bw.Flush()
+	if err != nil {
+		return err
+	}
+	return fillTemp(f, nil, mode, w)
+}
@@ -0,0 +1,57 @@
+package gfrn
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunkerReplace(t *testing.T) {
+	long := strings.Repeat("some words foo, and more ", streamChunk/8)
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"short lines", strings.Repeat("a foo line\n", 100)},
+		{"crlf", strings.Repeat("a foo line\r\n", streamChunk/8)},
+		{"one long line", long},
+		{"long lines", long + "\n" + long + "\n"},
+	}
+
+	m, _, err := compileMatcher(Options{Find: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantN := m.replaceAll([]byte(tt.in), "bar")
+
+			var got bytes.Buffer
+			n, lines := 0, 1
+			c := newChunker(strings.NewReader(tt.in), m)
+			for {
+				b, err := c.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.line != lines {
+					t.Fatalf("chunk starts on line %d, want %d", c.line, lines)
+				}
+				lines += bytes.Count(b, []byte("\n"))
+
+				out, k, _ := replaceChunk(b, m, "bar")
+				got.Write(out)
+				n += k
+			}
+
+			if n != wantN || !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("got %d matches, want %d, or the contents differ", n, wantN)
+			}
+		})
+	}
+}
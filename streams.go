@@ -0,0 +1,12 @@
+package gfrn
+
+// keepStreams copies the alternate data streams of path to the temp file about to replace
+// it, warning about any that can't be copied, which are lost with the old file
+func (e *Engine) keepStreams(path, temp string, streams []string) {
+	for _, s := range streams {
+		err := copyStream(path, temp, s)
+		if err != nil {
+			e.console.println("Couldn't keep stream", s, "of", path, "it will be lost,", err)
+		}
+	}
+}
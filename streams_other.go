@@ -0,0 +1,14 @@
+//go:build !windows
+
+package gfrn
+
+import "errors"
+
+// altStreams lists a file's alternate data streams, which only ntfs has
+func altStreams(path string) ([]string, error) {
+	return nil, nil
+}
+
+func copyStream(from, to, stream string) error {
+	return errors.New("alternate data streams are only on windows")
+}
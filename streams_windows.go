@@ -0,0 +1,65 @@
+package gfrn
+
+import (
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32         = windows.NewLazySystemDLL("kernel32.dll")
+	findFirstStreamW = kernel32.NewProc("FindFirstStreamW")
+	findNextStreamW  = kernel32.NewProc("FindNextStreamW")
+)
+
+// findStreamData is WIN32_FIND_STREAM_DATA
+type findStreamData struct {
+	size int64
+	name [windows.MAX_PATH + 36]uint16
+}
+
+// altStreams lists the alternate data streams of path, as ":name:$DATA", leaving out the
+// unnamed one that holds its contents. none on file systems without them
+func altStreams(path string) ([]string, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data findStreamData
+	h, _, err := findFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		if err == windows.ERROR_HANDLE_EOF || err == windows.ERROR_INVALID_PARAMETER || err == windows.ERROR_INVALID_FUNCTION {
+			return nil, nil // none, or not a file system with streams
+		}
+		return nil, err
+	}
+	defer windows.FindClose(windows.Handle(h))
+
+	var streams []string
+	for {
+		name := windows.UTF16ToString(data.name[:])
+		if name != "::$DATA" && strings.HasSuffix(name, ":$DATA") {
+			streams = append(streams, name)
+		}
+
+		ok, _, err := findNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if ok == 0 {
+			if err == windows.ERROR_HANDLE_EOF {
+				return streams, nil
+			}
+			return streams, err
+		}
+	}
+}
+
+// copyStream copies the stream of from to the same stream of to
+func copyStream(from, to, stream string) error {
+	b, err := os.ReadFile(from + stream)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to+stream, b, 0666)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gfrn
+
+import "os"
+
+func terminalRows(f *os.File) int {
+	return 24
+}
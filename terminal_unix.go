@@ -0,0 +1,18 @@
+//go:build unix
+
+package gfrn
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalRows is the height of the terminal f is attached to, 24 if it can't be told
+func terminalRows(f *os.File) int {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Row == 0 {
+		return 24
+	}
+	return int(ws.Row)
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package gfrn
+
+import "os"
+
+var processUmask os.FileMode
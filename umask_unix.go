@@ -0,0 +1,18 @@
+//go:build unix
+
+package gfrn
+
+import (
+	"os"
+	"syscall"
+)
+
+// processUmask is read once at startup. reading it means setting it, which isn't safe
+// once workers are creating files
+var processUmask = readUmask()
+
+func readUmask() os.FileMode {
+	m := syscall.Umask(0)
+	syscall.Umask(m)
+	return os.FileMode(m)
+}
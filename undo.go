@@ -0,0 +1,55 @@
+package gfrn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Undo reverses the last run made with Journal in the tree at dir, under its new name if it
+// was renamed: files get back what they held, then renames are reversed from the top of the
+// tree down, and the entry is removed
+func (e *Engine) Undo(dir string) error {
+	done := e.begin(Options{})
+	defer done()
+
+	root := dir
+	j, err := lastJournal(root)
+	if err != nil {
+		return fmt.Errorf("Couldn't load journal, %s", err)
+	}
+
+	for _, jf := range j.Files {
+		b, err := os.ReadFile(filepath.Join(j.path, filepath.FromSlash(jf.Backup)))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(root, filepath.FromSlash(jf.Path)), b, os.ModePerm)
+		}
+		if err != nil {
+			return fmt.Errorf("Couldn't restore %v, %s", jf.Path, err)
+		}
+	}
+
+	// forward order is parents first, so each rename's parent already has its old name back
+	for _, rn := range j.Renames {
+		if rn.Old == "." {
+			old := filepath.Join(filepath.Dir(root), filepath.Base(j.Dir))
+			err = os.Rename(root, old)
+			root = old
+		} else {
+			err = os.Rename(filepath.Join(root, filepath.FromSlash(rn.New)), filepath.Join(root, filepath.FromSlash(rn.Old)))
+		}
+		if err != nil {
+			return fmt.Errorf("Couldn't rename %v back to %v, %s", rn.New, rn.Old, err)
+		}
+	}
+
+	j.moved(root)
+	err = os.RemoveAll(j.path)
+	if err != nil {
+		e.console.println("Couldn't remove journal entry", j.path, err)
+	}
+	os.Remove(filepath.Join(root, journalDir)) // only goes if no other runs are recorded
+
+	e.console.println("Undid", len(j.Renames), "renames and", len(j.Files), "file changes in", root)
+	return nil
+}
@@ -0,0 +1,67 @@
+package gfrn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vcs moves files in a version controlled working copy so the version control system tracks
+// the move. anything it doesn't track is just renamed
+type vcs struct {
+	name, root string
+}
+
+// detectVCS finds the working copy dir is in, nil if it isn't in one
+func detectVCS(dir string) *vcs {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		for _, name := range []string{"git", "hg", "svn"} {
+			if _, err := os.Stat(filepath.Join(d, "."+name)); err == nil {
+				return &vcs{name: name, root: d}
+			}
+		}
+
+		if filepath.Dir(d) == d {
+			return nil
+		}
+	}
+}
+
+func (v *vcs) rename(old, new string) error {
+	switch v.name {
+	case "hg":
+		// hg rename only moves tracked files, so move everything and then tell hg about it
+		err := os.Rename(old, new)
+		if err != nil {
+			return err
+		}
+		v.run("rename", "--after", old, new)
+		return nil
+	case "git":
+		if v.run("mv", "--", old, new) == nil {
+			return nil
+		}
+	case "svn":
+		if v.run("move", "--quiet", old, new) == nil {
+			return nil
+		}
+	}
+	return os.Rename(old, new)
+}
+
+func (v *vcs) run(args ...string) error {
+	cmd := exec.Command(v.name, args...)
+	cmd.Dir = v.root
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", v.name, args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package gfrn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Verified is where one of a plan's renames or changed files stands in a tree
+type Verified struct {
+	Path   string `json:"path"` // as the plan has it, before any renames
+	Rename bool   `json:"rename,omitempty"`
+	Status string `json:"status"` // applied, pending, modified, missing or both
+}
+
+// the statuses Verify gives. both is a rename whose old and new names are both there,
+// modified a file that's neither as it was planned from nor as the plan makes it
+const (
+	StatusApplied  = "applied"
+	StatusPending  = "pending"
+	StatusModified = "modified"
+	StatusMissing  = "missing"
+	StatusBoth     = "both"
+)
+
+// Verify checks, without changing anything, how far a tree reflects a plan: for each rename
+// whether it's been made, and for each changed file whether it has the planned contents,
+// the contents it was planned from, under its old name or new, or neither. dir is the tree
+// to check when it isn't the one the plan was made against, like a backup, mirror or other
+// checkout, whatever it's called. it's an error unless everything is applied
+func (e *Engine) Verify(planPath, dir string) ([]Verified, error) {
+	done := e.begin(Options{})
+	defer done()
+
+	plan, err := LoadPlan(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load plan %v, %s", planPath, err)
+	}
+
+	root := plan.root()
+	if dir != "" {
+		root = filepath.Clean(dir)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("Couldn't verify %v, it isn't a directory", root)
+	}
+
+	list := []Verified{}
+	for _, rn := range plan.Renames {
+		list = append(list, Verified{Path: rn.Old, Rename: true, Status: renameStatus(plan, root, rn)})
+	}
+
+	// a file's looked for under its new name, then its old one, in case the renames
+	// haven't been made in the tree
+	type place struct{ final, old string }
+	places := make([]place, len(plan.Files))
+	paths := make(chan string, len(plan.Files)*2)
+	for i, pf := range plan.Files {
+		places[i] = place{filepath.Join(root, filepath.FromSlash(plan.finalPath(pf.Path))), filepath.Join(root, filepath.FromSlash(pf.Path))}
+		for _, p := range []string{places[i].final, places[i].old} {
+			if exists(p) {
+				paths <- p
+			}
+			if places[i].old == places[i].final {
+				break
+			}
+		}
+	}
+	close(paths)
+
+	hashes := map[string]string{}
+	for _, rd := range e.brokerRead(paths, &walkFilter{}, true) {
+		hashes[rd.Path] = rd.Hash
+	}
+
+	for i, pf := range plan.Files {
+		hash, ok := hashes[places[i].final]
+		if !ok {
+			hash, ok = hashes[places[i].old]
+		}
+
+		status := StatusModified
+		switch {
+		case !ok:
+			status = StatusMissing
+		case hash == pf.NewHash:
+			status = StatusApplied
+		case hash == pf.OldHash:
+			status = StatusPending
+		}
+		list = append(list, Verified{Path: pf.Path, Status: status})
+	}
+
+	counts := map[string]int{}
+	for _, v := range list {
+		counts[v.Status]++
+		kind := "file  "
+		if v.Rename {
+			kind = "rename"
+		}
+		e.console.printf("%-9s %s %s\n", v.Status, kind, v.Path)
+	}
+
+	if problems := len(list) - counts[StatusApplied]; problems > 0 {
+		tally := []string{}
+		for _, s := range []string{StatusPending, StatusModified, StatusMissing, StatusBoth} {
+			if counts[s] > 0 {
+				tally = append(tally, fmt.Sprintf("%d %s", counts[s], s))
+			}
+		}
+		return list, fmt.Errorf("%d problems found verifying %v: %s", problems, root, strings.Join(tally, ", "))
+	}
+
+	e.console.println("Verified", len(plan.Renames), "renames and", len(plan.Files), "files in", root)
+	return list, nil
+}
+
+// renameStatus is whether rn has been made under root: applied when only its new name's
+// there, pending when only its old one is, looking under both the old and new names of
+// its parent
+func renameStatus(plan Plan, root string, rn RenameOp) string {
+	if rn.Old == "." {
+		// the copy may be called anything, so only its name tells
+		if filepath.Base(root) == rn.New {
+			return StatusApplied
+		}
+		return StatusPending
+	}
+
+	final := filepath.Join(root, filepath.FromSlash(plan.finalPath(rn.Old)))
+	oldName := filepath.Base(filepath.FromSlash(rn.Old))
+	olds := []string{filepath.Join(root, filepath.FromSlash(rn.Old)), filepath.Join(filepath.Dir(final), oldName)}
+
+	found := exists
+	if strings.EqualFold(olds[1], final) {
+		found = exactName // a change of case only, which the file system may not tell apart
+	}
+
+	hasNew, hasOld := found(final), false
+	for _, old := range olds {
+		if old != final && found(old) {
+			hasOld = true
+		}
+	}
+
+	switch {
+	case hasNew && hasOld:
+		return StatusBoth
+	case hasNew:
+		return StatusApplied
+	case hasOld:
+		return StatusPending
+	}
+	return StatusMissing
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// exactName is whether path is there with its name cased just so
+func exactName(path string) bool {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	for _, d := range entries {
+		if d.Name() == filepath.Base(path) {
+			return true
+		}
+	}
+	return false
+}
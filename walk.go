@@ -0,0 +1,342 @@
+package gfrn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// walkFilter holds what every walk of the tree skips: ignored directories and files,
+// directories on other filesystems, and for the content pass, files that aren't text, whose sniffed
+// contents are of an excluded type, or that lack a required marker
+type walkFilter struct {
+	ignores     map[string]bool // directory and file names
+	ignoreGlobs []string        // and patterns for them, like *.snap
+	exts        map[string]bool
+	extCase     bool // exts are matched case sensitively, so .C and .c differ
+	detectText  bool // files are text by their first bytes, and with no exts, whatever their names
+	noContents  bool // no file's contents are searched, for a run that only renames
+	lnk         bool // .lnk shortcuts go through the content pass too, whatever exts says
+	noGo        bool // -semantic renamed in the go files, so the content pass leaves them be
+	xdev        bool
+	rootDev     uint64
+
+	excludeMime []string
+	ifContains  *regexp.Regexp
+
+	charset string // how contents are decoded, "" leaves them as bytes
+	owner   string // uid files must be owned by to be renamed or searched, "" for anyone
+	order   string // what order text files are sent in, "" for as the walk finds them
+	maxSize int64  // text files bigger than this are skipped, or streamed, 0 for no limit
+
+	root        string          // the top of the walk, where ignore files are read from down
+	ctx         context.Context // walks and reads stop once it's done, nil never stops them
+	ignoreFiles *ignoreFiles
+
+	// paths are as they were before renames until rebase is called
+	excludeFiles map[string]bool
+	onlyFiles    map[string]bool // nil for every text file
+
+	// files over maxSize, so each is dealt with once however many walks there are, and
+	// with streamLarge the ones left to stream
+	streamLarge bool
+	mu          sync.Mutex
+	oversized   map[string]bool
+	large       []string
+}
+
+// stopped is true once the run has been told to stop
+func (wf *walkFilter) stopped() bool {
+	return wf.ctx != nil && wf.ctx.Err() != nil
+}
+
+// fileID tells hardlinks to the same file apart from copies of it
+type fileID struct {
+	dev, ino uint64
+}
+
+func newWalkFilter(dir string, ignores, exts map[string]bool, xdev bool) *walkFilter {
+	wf := &walkFilter{ignores: ignores, exts: exts, xdev: xdev, root: dir}
+	for name := range ignores {
+		if strings.ContainsAny(name, "*?[") {
+			wf.ignoreGlobs = append(wf.ignoreGlobs, name)
+		}
+	}
+	if xdev {
+		if info, err := os.Stat(dir); err == nil {
+			wf.rootDev, _ = deviceOf(info)
+		}
+	}
+	return wf
+}
+
+// skipDir is true for directories the walk shouldn't descend into
+func (wf *walkFilter) skipDir(path string, d fs.DirEntry) bool {
+	if !d.IsDir() {
+		return false
+	}
+
+	if wf.ignoredName(d.Name()) || wf.ignoreFiles != nil && wf.ignoreFiles.ignored(wf.root, path, true) {
+		return true
+	}
+
+	if wf.xdev {
+		if info, err := d.Info(); err == nil {
+			if dev, ok := deviceOf(info); ok && dev != wf.rootDev {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ignoredFile is true for files neither renamed nor searched because of their names, or
+// because an ignore file says so
+func (wf *walkFilter) ignoredFile(path string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return false
+	}
+	return wf.ignoredName(d.Name()) || wf.ignoreFiles != nil && wf.ignoreFiles.ignored(wf.root, path, false)
+}
+
+// notOwned is true for files and directories that aren't the owner's, which are left alone,
+// though the walk still goes into directories to find the owner's files in them
+func (wf *walkFilter) notOwned(d fs.DirEntry) bool {
+	if wf.owner == "" {
+		return false
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return true
+	}
+	uid, ok := ownerOf(info)
+	return ok && uid != wf.owner
+}
+
+// ignoredName is true for names in the ignore list or matching a pattern in it
+func (wf *walkFilter) ignoredName(name string) bool {
+	name = strings.ToLower(name)
+	if wf.ignores[name] {
+		return true
+	}
+
+	for _, pattern := range wf.ignoreGlobs {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// textFile is true for files whose contents the run should search
+func (wf *walkFilter) textFile(path string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return false
+	}
+
+	if wf.onlyFiles != nil && !wf.onlyFiles[path] || wf.excludedPath(path) || wf.ignoredFile(path, d) || wf.notOwned(d) {
+		return false
+	}
+	if wf.lnk && isShortcut(path) {
+		return true
+	}
+	if wf.noGo && strings.EqualFold(filepath.Ext(path), ".go") {
+		return false
+	}
+
+	return !wf.noContents && wf.textName(d.Name())
+}
+
+// tooBig is true for files over maxSize, which aren't read into memory. they're skipped,
+// which skip says the first time the file's found, or with streamLarge kept for
+// streamFiles to replace in a chunk at a time
+func (wf *walkFilter) tooBig(path string, size int64) (big, skip bool) {
+	if wf.maxSize <= 0 || size <= wf.maxSize {
+		return false, false
+	}
+
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	if wf.oversized[path] {
+		return true, false
+	}
+	if wf.oversized == nil {
+		wf.oversized = map[string]bool{}
+	}
+	wf.oversized[path] = true
+
+	if wf.streamLarge {
+		wf.large = append(wf.large, path)
+		return true, false
+	}
+	return true, true
+}
+
+// takeLarge returns the files the walks so far found to stream, and forgets them
+func (wf *walkFilter) takeLarge() []string {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	list := wf.large
+	wf.large = nil
+	sort.Strings(list)
+	return list
+}
+
+// largeFiles is takeLarge without forgetting them, for what looks before the content pass
+func (wf *walkFilter) largeFiles() []string {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	list := append([]string{}, wf.large...)
+	sort.Strings(list)
+	return list
+}
+
+// textName is true for file names with one of the text extensions. extensions can have
+// more than one dot, like d.ts or conf.j2, so every dotted suffix of the name is tried
+func (wf *walkFilter) textName(name string) bool {
+	if wf.detectText && len(wf.exts) == 0 {
+		return true
+	}
+
+	if !wf.extCase {
+		name = strings.ToLower(name)
+	}
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if _, ok := wf.exts[name[i:]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedContent is true when the sniffed mime type of b matches one of the excluded
+// types, so files with misleading extensions are judged by what they actually are, or
+// when b doesn't contain the marker that makes a file eligible
+func (wf *walkFilter) excludedContent(b []byte) bool {
+	if wf.ifContains != nil && !wf.ifContains.Match(b) {
+		return true
+	}
+	return wf.excludedType(b)
+}
+
+// excludedType is true when the sniffed mime type of b matches one of the excluded types
+func (wf *walkFilter) excludedType(b []byte) bool {
+	if len(wf.excludeMime) == 0 {
+		return false
+	}
+
+	mt := http.DetectContentType(b)
+	if i := strings.Index(mt, ";"); i != -1 {
+		mt = mt[:i]
+	}
+
+	for _, pattern := range wf.excludeMime {
+		if ok, _ := path.Match(pattern, mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffLen is how much of a file looksText reads, the same as git looks at
+const sniffLen = 8000
+
+// looksText is true when the start of the file at path has no NUL bytes, unless it's
+// utf-16, and is valid utf-8, unless the charset is one that reads any bytes as text.
+// a multibyte character cut off at sniffLen doesn't count against it
+func (wf *walkFilter) looksText(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	b = b[:n]
+
+	charset := wf.charset
+	if charset == "auto" {
+		charset = detectCharset(b)
+	}
+	if strings.HasPrefix(charset, "utf-16") {
+		return true
+	}
+	if bytes.IndexByte(b, 0) != -1 {
+		return false
+	}
+	if charset != "" && charset != "utf-8" {
+		return true
+	}
+
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 && (n < sniffLen || utf8.FullRune(b)) {
+			return false
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// excludedPath is true for files, or directories, the run should leave completely alone
+func (wf *walkFilter) excludedPath(path string) bool {
+	return wf.excludeFiles[path]
+}
+
+// rebase moves the path based filters to where the renames put their files
+func (wf *walkFilter) rebase(renames []RenameOp) {
+	renamed := renameMap(renames)
+	wf.root = renamedPath(renamed, wf.root)
+	wf.excludeFiles = rebasePaths(wf.excludeFiles, renamed)
+	wf.onlyFiles = rebasePaths(wf.onlyFiles, renamed)
+
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	wf.oversized = rebasePaths(wf.oversized, renamed)
+	for i, p := range wf.large {
+		wf.large[i] = renamedPath(renamed, p)
+	}
+}
+
+func rebasePaths(set map[string]bool, renamed map[string]string) map[string]bool {
+	if set == nil {
+		return nil
+	}
+
+	m := make(map[string]bool, len(set))
+	for p := range set {
+		m[renamedPath(renamed, p)] = true
+	}
+	return m
+}
+
+// pathSet resolves paths given relative to dir, with either separator, to the paths a walk of dir produces
+func pathSet(dir string, list []string) map[string]bool {
+	m := make(map[string]bool, len(list))
+	for _, p := range list {
+		p = nativeSeparators(p)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		m[filepath.Clean(p)] = true
+	}
+	return m
+}